@@ -0,0 +1,106 @@
+package main
+
+import (
+	"assignment/config"
+	"assignment/internal/watch"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+const defaultConfigFile = "config/app_configuration.json"
+
+// cliOptions are the command-line settings that are not part of the extraction configuration
+type cliOptions struct {
+	configFile    string
+	configFileSet bool // The configuration file was named explicitly, so it has to exist
+	logLevel      string
+	logFormat     string
+	dryRun        bool
+	version       bool
+	metricsAddr   string       // Address serving Prometheus metrics during the run, disabled when empty
+	watch         watch.Config // Watch mode settings, the mode is off unless watch.Inbox is set
+	overrides     []override
+}
+
+// override is a configuration setting given on the command line
+type override struct {
+	name  string
+	value string
+}
+
+// parseFlags parses the command line. A flag is generated for every configuration setting from config.Fields,
+// values are checked while parsing and applied later, on top of the loaded configuration.
+func parseFlags(args []string, output io.Writer) (*cliOptions, error) {
+	opts := &cliOptions{}
+	flags := flag.NewFlagSet("data_extraction", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.Usage = func() {
+		fmt.Fprintf(output, "Usage: data_extraction [flags]\n\n")
+		fmt.Fprintf(output, "Extracts rows from newline delimited JSON. Configuration flags override the\n")
+		fmt.Fprintf(output, "%s* environment variables, which override the configuration file.\n\n", config.EnvPrefix)
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&opts.configFile, "config", defaultConfigFile, "configuration file (JSON, YAML or TOML), optional unless set explicitly")
+	flags.StringVar(&opts.logLevel, "logLevel", "info", "log level: debug, info, warn or error")
+	flags.StringVar(&opts.logFormat, "logFormat", "text", "log format: text or json")
+	flags.BoolVar(&opts.dryRun, "dryRun", false, "validate the configuration, print it and exit")
+	flags.BoolVar(&opts.version, "version", false, "print the version and exit")
+	flags.StringVar(&opts.metricsAddr, "metricsAddr", "", "serve Prometheus metrics on this address during the run, e.g. :8081")
+	flags.StringVar(&opts.watch.Inbox, "watch", "", "watch this inbox directory and extract every file landing in it, instead of inputFileName")
+	flags.StringVar(&opts.watch.ProcessedDir, "processedDir", "", "watch mode: directory receiving the extracted files (default <inbox>/"+watch.ProcessedDir+")")
+	flags.StringVar(&opts.watch.FailedDir, "failedDir", "", "watch mode: directory receiving the files whose extraction failed (default <inbox>/"+watch.FailedDir+")")
+	flags.DurationVar(&opts.watch.StableFor, "stableFor", watch.DefaultStableFor, "watch mode: time a file has to stay unchanged before it is extracted")
+	flags.StringVar(&opts.watch.DoneSuffix, "doneSuffix", "", "watch mode: extract a file once a marker named after it with this suffix exists, e.g. .done")
+
+	for _, field := range config.Fields() {
+		name := field.Name
+		set := func(value string) error {
+			// Reject invalid values while parsing, the flag package already names the flag and the value
+			if err := new(config.AppConfig).Set(name, value); err != nil {
+				return errors.Unwrap(err)
+			}
+			opts.overrides = append(opts.overrides, override{name: name, value: value})
+			return nil
+		}
+		if field.Type == "bool" {
+			flags.BoolFunc(name, fmt.Sprintf("%s ($%s)", field.Usage, field.EnvName), set)
+		} else {
+			// The back-quoted type is shown as the placeholder of the flag value in the help output
+			flags.Func(name, fmt.Sprintf("%s (`%s`, $%s)", field.Usage, field.Type, field.EnvName), set)
+		}
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return nil, fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			opts.configFileSet = true
+		}
+	})
+	return opts, nil
+}
+
+// apply sets the settings given on the command line. In watch mode the inbox stands in for the input,
+// each of its files is extracted on its own.
+func (o *cliOptions) apply(cfg *config.AppConfig) error {
+	for _, override := range o.overrides {
+		if err := cfg.Set(override.name, override.value); err != nil {
+			return err
+		}
+	}
+	if o.watch.Inbox != "" {
+		cfg.InputFileName = config.InputFiles{o.watch.Inbox}
+	}
+	return nil
+}
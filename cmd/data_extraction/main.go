@@ -4,34 +4,128 @@ import (
 	"assignment/config"
 	"assignment/internal/service"
 	"assignment/pkg/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	// Initialize logger with default configuration
+	opts, err := parseFlags(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+	if opts.version {
+		fmt.Println("data_extraction", version)
+		return
+	}
+
+	// Initialize logger
 	logConfig := logger.LogConfig{
-		Level:      "info",
-		Format:     "text",
+		Level:      opts.logLevel,
+		Format:     opts.logFormat,
 		OutputPath: "",
 	}
 	if err := logger.InitLogger(logConfig); err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, "Invalid log settings:", err)
+		os.Exit(2)
 	}
 
-	// Load configuration
-	config, err := config.LoadConfig("config/app_configuration.json")
+	// Load configuration and environment overrides, then apply the command-line settings on top of them
+	config, err := loadConfig(opts)
 	if err != nil {
-		logger.Fatal("Failed to load configuration", logrus.Fields{"error": err})
+		logger.Fatal("Failed to load configuration", logger.Fields{"error": err})
+	}
+	if config.OutputFileName == service.StdioFileName || opts.dryRun {
+		// Standard output carries the extracted rows or the configuration, keep the logs out of it
+		logConfig.OutputPath = "stderr"
+		if err := logger.InitLogger(logConfig); err != nil {
+			panic(err)
+		}
 	}
 
 	// Extract input file
-	extractionManager := service.NewExtractionManager(
-		config.InputFileName,
-		config.OutputFileName,
-		config.NumWorkers,
-		config.LinesPerFile,
-		config.LinesChannelSize,
-		config.ResultsChannelSize,
+	extractionManager, err := newManager(config)
+	if err != nil {
+		logger.Fatal("Invalid extraction configuration", logrus.Fields{"error": err})
+	}
+	if opts.watch.Inbox != "" {
+		if err := checkWatchConfig(config, opts.watch.Inbox); err != nil {
+			logger.Fatal("Invalid watch configuration", logrus.Fields{"error": err})
+		}
+	}
+	if opts.dryRun {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(config); err != nil {
+			logger.Fatal("Failed to print configuration", logrus.Fields{"error": err})
+		}
+		return
+	}
+
+	if opts.metricsAddr != "" {
+		go serveMetrics(opts.metricsAddr)
+	}
+
+	// Stop reading on SIGINT/SIGTERM, the lines already read are still written out
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if opts.watch.Inbox != "" {
+		if err := watchInbox(ctx, opts.watch, config); err != nil {
+			logger.Fatal("Watch mode failed", logrus.Fields{"error": err})
+		}
+		return
+	}
+
+	if _, err := extractionManager.Extract(ctx); err != nil {
+		if errors.Is(err, context.Canceled) {
+			stop()
+			os.Exit(130)
+		}
+		logger.Fatal("Extraction failed", logrus.Fields{"error": err})
+	}
+}
+
+// newManager builds the extraction of a loaded configuration
+func newManager(cfg *config.AppConfig) (*service.ExtractionManager, error) {
+	return service.NewExtractionManager(
+		cfg.InputFileName.String(),
+		cfg.OutputFileName,
+		int(cfg.NumWorkers),
+		cfg.LinesPerFile,
+		int(cfg.LinesChannelSize),
+		int(cfg.ResultsChannelSize),
+		service.ConfigOptions(cfg)...,
 	)
-	extractionManager.Extract()
+}
+
+// loadConfig reads the configuration file, the environment overrides and the command-line settings.
+// The default configuration file is optional, so every setting can come from the environment or flags.
+func loadConfig(opts *cliOptions) (*config.AppConfig, error) {
+	configFile := opts.configFile
+	if _, err := os.Stat(configFile); errors.Is(err, fs.ErrNotExist) && !opts.configFileSet {
+		configFile = ""
+	}
+	return config.LoadConfig(configFile, opts.apply)
+}
+
+// serveMetrics exposes the Prometheus metrics of the run on /metrics
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Error("Metrics server failed", logrus.Fields{"error": err})
+	}
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"assignment/config"
+	"assignment/internal/service"
+	"assignment/internal/watch"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// checkWatchConfig rejects the settings that cannot be shared by the runs of watch mode
+func checkWatchConfig(cfg *config.AppConfig, inbox string) error {
+	if cfg.CheckpointFileName != "" {
+		return errors.New("checkpoints are not supported in watch mode, an interrupted file is extracted again from the start")
+	}
+	for _, file := range []config.FileName{
+		{Field: "outputFileName", Name: cfg.OutputFileName},
+		{Field: "deadLetterFileName", Name: cfg.DeadLetterFileName},
+		{Field: "manifestFileName", Name: cfg.ManifestFileName},
+	} {
+		if file.Name == "" || file.Name == service.StdioFileName {
+			continue
+		}
+		if !perRun(file.Name, cfg.RunID) {
+			if cfg.RunID != "" {
+				return fmt.Errorf("in watch mode %s needs {run} and runId must not be set, or the runs overwrite each other's files", file.Field)
+			}
+			return fmt.Errorf("in watch mode %s needs {run}, or the runs overwrite each other's files", file.Field)
+		}
+		inside, err := underDir(file.Name, inbox)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Field, err)
+		}
+		if inside {
+			return fmt.Errorf("in watch mode %s must be outside the inbox %s, or its files are extracted again", file.Field, inbox)
+		}
+	}
+	return nil
+}
+
+// perRun reports whether a file name template differs between the runs of watch mode. Only {run} does, and
+// only when the run ID is generated: {timestamp} is the same for the runs of one second and {input} for
+// spins.jsonl and spins.jsonl.gz.
+func perRun(template, runID string) bool {
+	return runID == "" && strings.Contains(template, "{"+service.PlaceholderRun+"}")
+}
+
+// underDir reports whether the files of a file name template are created in dir or one of its subdirectories
+func underDir(template, dir string) (bool, error) {
+	file, err := filepath.Abs(template)
+	if err != nil {
+		return false, err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		return false, nil
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+// watchInbox extracts every file landing in the inbox with the loaded configuration, until ctx is cancelled
+func watchInbox(ctx context.Context, watchConfig watch.Config, cfg *config.AppConfig) error {
+	extract := func(ctx context.Context, inputFile string) error {
+		fileConfig := *cfg
+		fileConfig.InputFileName = config.InputFiles{inputFile}
+		manager, err := newManager(&fileConfig)
+		if err != nil {
+			return err
+		}
+		_, err = manager.Extract(ctx)
+		return err
+	}
+	watcher, err := watch.New(watchConfig, extract)
+	if err != nil {
+		return err
+	}
+	return watcher.Run(ctx)
+}
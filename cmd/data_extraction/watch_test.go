@@ -0,0 +1,48 @@
+package main
+
+import (
+	"assignment/config"
+	"strings"
+	"testing"
+)
+
+func TestPerRun(t *testing.T) {
+	for _, test := range []struct {
+		template, runID string
+		expected        bool
+	}{
+		{"out/{run}-{index}.csv", "", true},
+		{"out/{input}-{run}.csv", "", true},
+		{"out/{run}-{index}.csv", "nightly", false},
+		{"out/{input}-{index}.csv", "", false},
+		{"out/{timestamp}-{index}.csv", "", false},
+		{"out/{date}/{index}.csv", "", false},
+	} {
+		if actual := perRun(test.template, test.runID); actual != test.expected {
+			t.Errorf("perRun(%q, %q) = %v, expected %v", test.template, test.runID, actual, test.expected)
+		}
+	}
+}
+
+func TestCheckWatchConfig(t *testing.T) {
+	inbox := t.TempDir()
+	for _, test := range []struct {
+		cfg     config.AppConfig
+		message string
+	}{
+		{config.AppConfig{OutputFileName: "out/{input}-{run}.csv", DeadLetterFileName: "out/{run}.rejected.ndjson"}, ""},
+		{config.AppConfig{OutputFileName: "-", ManifestFileName: "out/{run}.manifest.json"}, ""},
+		{config.AppConfig{OutputFileName: "out/{input}.csv"}, "outputFileName needs {run}"},
+		{config.AppConfig{OutputFileName: "out/{timestamp}.csv"}, "outputFileName needs {run}"},
+		{config.AppConfig{OutputFileName: "out/{run}.csv", DeadLetterFileName: "out/{input}.ndjson"}, "deadLetterFileName needs {run}"},
+		{config.AppConfig{OutputFileName: "out/{run}.csv", RunID: "nightly"}, "runId must not be set"},
+		{config.AppConfig{OutputFileName: inbox + "/{run}.csv"}, "outputFileName must be outside the inbox"},
+		{config.AppConfig{OutputFileName: "out/{run}.csv", ManifestFileName: inbox + "/out/{run}.json"}, "manifestFileName must be outside the inbox"},
+		{config.AppConfig{OutputFileName: "out/{run}.csv", CheckpointFileName: "checkpoint.json"}, "checkpoints are not supported"},
+	} {
+		err := checkWatchConfig(&test.cfg, inbox)
+		if test.message == "" && err != nil || test.message != "" && (err == nil || !strings.Contains(err.Error(), test.message)) {
+			t.Errorf("checkWatchConfig(%+v): expected %q, got %v", test.cfg, test.message, err)
+		}
+	}
+}
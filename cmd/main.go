@@ -1,14 +1,18 @@
 package main
 
 import (
-    "assignment/pkg/config"
+    "assignment/config"
+    "assignment/internal/jobs"
     "assignment/pkg/health"
     "assignment/pkg/logger"
-    "assignment/pkg/metrics"
     "context"
+    "errors"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    "io/fs"
     "net/http"
     "os"
     "os/signal"
+    "strconv"
     "syscall"
     "time"
 )
@@ -24,32 +28,63 @@ func main() {
         panic(err)
     }
 
-    // Load and validate configuration
-    cfg, err := config.LoadConfig(getEnvOrDefault("CONFIG_FILE", "config/app_configuration.json"))
+    // Load the job defaults, every setting a submitted job leaves out is taken from them
+    configFile := getEnvOrDefault("CONFIG_FILE", "config/app_configuration.json")
+    if _, err := os.Stat(configFile); errors.Is(err, fs.ErrNotExist) {
+        configFile = ""
+    }
+    defaults, err := config.ReadConfig(configFile)
     if err != nil {
         logger.Fatal("Failed to load configuration", logger.Fields{"error": err})
     }
-    
-    if err := cfg.ValidateConfig(); err != nil {
-        logger.Fatal("Invalid configuration", logger.Fields{"error": err})
+
+    // Start the job pool
+    numWorkers, err := strconv.Atoi(getEnvOrDefault("JOB_WORKERS", "2"))
+    if err != nil {
+        logger.Fatal("Invalid JOB_WORKERS", logger.Fields{"error": err})
+    }
+    queueSize, err := strconv.Atoi(getEnvOrDefault("JOB_QUEUE_SIZE", "16"))
+    if err != nil {
+        logger.Fatal("Invalid JOB_QUEUE_SIZE", logger.Fields{"error": err})
+    }
+    // Keep the job history in a file when JOB_STORE is set, in memory otherwise
+    var store jobs.Store
+    if path := getEnvOrDefault("JOB_STORE", ""); path != "" {
+        if store, err = jobs.OpenBoltStore(path); err != nil {
+            logger.Fatal("Failed to open the job store", logger.Fields{"error": err})
+        }
+    } else {
+        store = jobs.NewMemoryStore()
+    }
+    defer store.Close()
+    // Jobs only read and write files inside JOB_DATA_ROOT
+    pool, err := jobs.NewPool(numWorkers, queueSize, store, getEnvOrDefault("JOB_DATA_ROOT", "data"))
+    if err != nil {
+        logger.Fatal("Failed to start the job pool", logger.Fields{"error": err})
+    }
+    scheduler, err := jobs.NewScheduler(pool)
+    if err != nil {
+        logger.Fatal("Failed to start the scheduler", logger.Fields{"error": err})
     }
 
     // Initialize health checker
     healthChecker := health.NewHealthChecker(30 * time.Second)
     
     // Add health checks
-    healthChecker.AddCheck("config", func() error {
-        if err := cfg.ValidateConfig(); err != nil {
-            return err
-        }
-        return nil
-    })
+    healthChecker.AddCheck("jobs", pool.Accepting)
     
-    // Start health check server
+    // Start the job API and health check server
+    mux := http.NewServeMux()
+    mux.Handle("/health", healthChecker)
+    jobHandler := jobs.NewHandler(pool, scheduler, *defaults)
+    mux.Handle("/jobs", jobHandler)
+    mux.Handle("/jobs/", jobHandler)
+    mux.Handle("/schedules", jobHandler)
+    mux.Handle("/schedules/", jobHandler)
+    server := &http.Server{Addr: ":8080", Handler: mux}
     go func() {
-        http.Handle("/health", healthChecker)
-        if err := http.ListenAndServe(":8080", nil); err != nil {
-            logger.Error("Health check server failed", logger.Fields{"error": err})
+        if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+            logger.Error("Job API server failed", logger.Fields{"error": err})
         }
     }()
 
@@ -65,15 +100,20 @@ func main() {
     ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
     defer stop()
 
-    // Start your application processing here
-    // ... (your existing processing logic) ...
-
     // Wait for shutdown signal
     <-ctx.Done()
     logger.Info("Shutting down gracefully", logger.Fields{})
-    
-    // Add cleanup logic here
-    // ... (your cleanup logic) ...
+
+    // Stop taking jobs, then cancel the running ones, which flush their output and keep their checkpoints
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+    if err := server.Shutdown(shutdownCtx); err != nil {
+        logger.Error("Job API server shutdown failed", logger.Fields{"error": err})
+    }
+    scheduler.Stop()
+    if err := pool.Shutdown(shutdownCtx); err != nil {
+        logger.Error("Jobs did not stop in time", logger.Fields{"error": err})
+    }
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
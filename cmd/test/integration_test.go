@@ -4,6 +4,7 @@ import (
 	"assignment/config"
 	"assignment/internal/service"
 	"assignment/pkg/logger"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -15,7 +16,7 @@ import (
 
 func TestIntegration(t *testing.T) {
 
-	logger.InitLogger()
+	logger.InitLogger(logger.LogConfig{Level: "info"})
 	configFile := "test_config.json"
 	configContent := `{
   "inputFileName": "test_input.json",
@@ -36,19 +37,21 @@ func TestIntegration(t *testing.T) {
 		t.Fatalf("Failed to load config: %v", err)
 	}
 
-	generator := NewInputFileGenerator(cfg.InputFileName)
+	generator := NewInputFileGenerator(cfg.InputFileName.String())
 	generator.Generate()
-	defer os.Remove(cfg.InputFileName)
+	defer os.Remove(cfg.InputFileName.String())
 
-	parser := service.NewExtractionManager(
-		cfg.InputFileName,
+	parser, err := service.NewExtractionManager(
+		cfg.InputFileName.String(),
 		cfg.OutputFileName,
-		cfg.NumWorkers,
+		int(cfg.NumWorkers),
 		cfg.LinesPerFile,
-		cfg.LinesChannelSize,
-		cfg.ResultsChannelSize,
+		int(cfg.LinesChannelSize),
+		int(cfg.ResultsChannelSize),
 	)
-	go parser.Extract() // Ensure the method is invoked
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
 
 	// Remove all output files after the test
 	for i := 0; i < 100; i++ { // Assuming a maximum of 100 output files
@@ -56,8 +59,9 @@ func TestIntegration(t *testing.T) {
 		defer os.Remove(outputFileName)
 	}
 
-	// Wait for the files to be created
-	time.Sleep(100 * time.Millisecond)
+	if _, err := parser.Extract(context.Background()); err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
 
 	outputFileName := "output-0.csv"
 	file, err := os.Open(outputFileName)
@@ -3,31 +3,236 @@ package config
 import (
 	"assignment/pkg/logger"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"os"
+	"strconv"
+	"strings"
 )
 
+// AppConfig is the extraction configuration. The usage tags document each setting on the command line.
 type AppConfig struct {
-	InputFileName      string `json:"inputFileName"`
-	OutputFileName     string `json:"outputFileName"`
-	NumWorkers         int    `json:"numWorkers"`
-	LinesPerFile       int    `json:"linesPerFile"`
-	LinesChannelSize   int    `json:"linesChannelSize"`
-	ResultsChannelSize int    `json:"resultsChannelSize"`
+	InputFileName      InputFiles     `json:"inputFileName" usage:"input files, directories or globs, comma separated, \"-\" for stdin"`
+	OutputFileName     string         `json:"outputFileName" usage:"output file name template, \"-\" for stdout"`
+	NumWorkers         AutoInt        `json:"numWorkers" usage:"number of parsing workers, or auto"`
+	LinesPerFile       int            `json:"linesPerFile" usage:"rows per output file"`
+	LinesChannelSize   AutoInt        `json:"linesChannelSize" usage:"capacity of the channel feeding the workers, or auto"`
+	ResultsChannelSize AutoInt        `json:"resultsChannelSize" usage:"capacity of the channel feeding the writer, or auto"`
+	Columns            []ColumnConfig `json:"columns" usage:"output columns as a JSON array of {source, name, type, required}"`
+	OutputFormat       string         `json:"outputFormat" usage:"csv, tsv, ndjson or parquet"`
+	RunID              string         `json:"runId" usage:"run ID substituted for {run}, generated when empty"`
+	PartitionKey       string         `json:"partitionKey" usage:"value substituted for {partition}"`
+
+	// Malformed lines are written to DeadLetterFileName when it is set. The run fails when more than
+	// MaxMalformedLines lines or MaxMalformedPercent percent of the lines are malformed, 0 disables a limit.
+	DeadLetterFileName  string  `json:"deadLetterFileName" usage:"NDJSON file receiving malformed lines"`
+	MaxMalformedLines   int64   `json:"maxMalformedLines" usage:"fail once more lines are malformed, 0 for no limit"`
+	MaxMalformedPercent float64 `json:"maxMalformedPercent" usage:"fail when a larger percentage of lines is malformed, 0 for no limit"`
+
+	// ManifestFileName receives a JSON manifest of the output files, with their checksums, once a run completes
+	ManifestFileName string `json:"manifestFileName" usage:"JSON manifest written once a run completes"`
+
+	// PreserveOrder writes rows in input order, holding at most ReorderBufferSize lines in flight
+	PreserveOrder     bool `json:"preserveOrder" usage:"write rows in input order"`
+	ReorderBufferSize int  `json:"reorderBufferSize" usage:"lines in flight when preserving order"`
+
+	// Progress is saved to CheckpointFileName every CheckpointEvery lines, Resume continues from it
+	CheckpointFileName string `json:"checkpointFileName" usage:"file the progress is saved to"`
+	CheckpointEvery    int64  `json:"checkpointEvery" usage:"lines between checkpoints"`
+	Resume             bool   `json:"resume" usage:"continue from the checkpoint file"`
+
+	// MaxLineSize is the longest input line in bytes, longer lines are rejected as malformed.
+	// 0 selects the default of 16 MiB and -1 disables the limit.
+	MaxLineSize int `json:"maxLineSize" usage:"longest input line in bytes, 0 for 16 MiB, -1 for no limit"`
+
+	// InputCompression is auto (default, detected from the file content), none, gzip, zstd, bzip2 or xz
+	InputCompression string `json:"inputCompression" usage:"auto, none, gzip, zstd, bzip2 or xz"`
+
+	// InputParallelism is the number of input files read at the same time, 1 by default.
+	// Files read in parallel cannot be combined with PreserveOrder or checkpoints.
+	InputParallelism int `json:"inputParallelism" usage:"input files read at the same time"`
+
+	// OutputCompression is none (default), gzip or zstd, at OutputCompressionLevel (0 for the default level).
+	// Output files are rotated after LinesPerFile rows or, when MaxBytesPerFile is set, once they reach that size.
+	OutputCompression      string `json:"outputCompression" usage:"none, gzip or zstd"`
+	OutputCompressionLevel int    `json:"outputCompressionLevel" usage:"compression level, 0 for the default"`
+	MaxBytesPerFile        int64  `json:"maxBytesPerFile" usage:"also rotate output files at this size, 0 for no limit"`
+
+	// AdaptiveWorkers adds workers while they fall behind the reader and retires them while they wait for it
+	AdaptiveWorkers bool `json:"adaptiveWorkers" usage:"resize the worker pool during the run"`
+}
+
+// FileName is a setting naming a file, or a file name template
+type FileName struct {
+	Field string // JSON key of the setting
+	Name  string
+}
+
+// FileNames lists the files of the configuration: every input, the output, and the dead-letter, manifest and
+// checkpoint files when they are set
+func (c *AppConfig) FileNames() []FileName {
+	var names []FileName
+	for _, input := range c.InputFileName {
+		names = append(names, FileName{"inputFileName", input})
+	}
+	names = append(names, FileName{"outputFileName", c.OutputFileName})
+	for _, optional := range []FileName{
+		{"deadLetterFileName", c.DeadLetterFileName},
+		{"manifestFileName", c.ManifestFileName},
+		{"checkpointFileName", c.CheckpointFileName},
+	} {
+		if optional.Name != "" {
+			names = append(names, optional)
+		}
+	}
+	return names
+}
+
+// MapFileNames replaces every file name listed by FileNames with mapping(name). InputFileName is replaced
+// by a new slice, so copies of the configuration are left alone.
+func (c *AppConfig) MapFileNames(mapping func(name string) string) {
+	inputs := make(InputFiles, len(c.InputFileName))
+	for i, input := range c.InputFileName {
+		inputs[i] = mapping(input)
+	}
+	c.InputFileName = inputs
+	c.OutputFileName = mapping(c.OutputFileName)
+	for _, name := range []*string{&c.DeadLetterFileName, &c.ManifestFileName, &c.CheckpointFileName} {
+		if *name != "" {
+			*name = mapping(*name)
+		}
+	}
+}
+
+// AutoInt is a size that can also be "auto", to be derived from the CPUs and the input size at run time
+type AutoInt int
+
+// Auto is the AutoInt value of "auto"
+const Auto AutoInt = -1
+
+var errNotAutoInt = errors.New(`expected an integer or "auto"`)
+
+// within reports whether n is Auto or between 1 and limit
+func (n AutoInt) within(limit int) bool {
+	return n == Auto || (n > 0 && int(n) <= limit)
+}
+
+func (n *AutoInt) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return n.UnmarshalText([]byte(text))
+	}
+	var value int
+	if err := json.Unmarshal(data, &value); err != nil {
+		return errNotAutoInt
+	}
+	*n = AutoInt(value)
+	return nil
 }
 
-func LoadConfig(configFile string) (*AppConfig, error) {
-	file, err := os.Open(configFile)
+func (n AutoInt) MarshalJSON() ([]byte, error) {
+	if n == Auto {
+		return []byte(`"auto"`), nil
+	}
+	return json.Marshal(int(n))
+}
+
+// UnmarshalText accepts "auto" or an integer
+func (n *AutoInt) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+	if strings.EqualFold(value, "auto") {
+		*n = Auto
+		return nil
+	}
+	i, err := strconv.Atoi(value)
 	if err != nil {
-		return nil, err
+		return errNotAutoInt
+	}
+	*n = AutoInt(i)
+	return nil
+}
+
+func (n AutoInt) String() string {
+	if n == Auto {
+		return "auto"
 	}
-	defer file.Close()
+	return strconv.Itoa(int(n))
+}
+
+// InputFiles lists input files, directories and globs, read in order as a single input.
+// In JSON it is either a single string or an array of strings.
+type InputFiles []string
+
+func (f *InputFiles) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*f = nil
+		if single != "" {
+			*f = InputFiles{single}
+		}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("inputFileName must be a string or an array of strings: %w", err)
+	}
+	*f = list
+	return nil
+}
 
+// String returns the inputs separated by commas, which is the single input when there is only one
+func (f InputFiles) String() string {
+	return strings.Join(f, ",")
+}
+
+// ColumnConfig declares one output column: where to read it from in the input
+// record (dot separated JSON path), how to name it and which type it has
+// ("string", "int", "float" or "bool"). When no columns are configured the
+// extraction emits spins and server_time.
+type ColumnConfig struct {
+	Source   string `json:"source"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+// ReadConfig reads a JSON, YAML or TOML configuration file (see decodeConfig) and applies the environment
+// variable overrides (see ApplyEnv), without validating the result. An empty configFile starts from an
+// empty configuration.
+func ReadConfig(configFile string) (*AppConfig, error) {
 	var config AppConfig
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		logger.Error("Failed to decode configuration", logrus.Fields{"error": err})
+	if configFile != "" {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := decodeConfig(configFile, data, &config); err != nil {
+			logger.Error("Failed to decode configuration", logrus.Fields{"error": err})
+			return nil, err
+		}
+	}
+	if err := config.ApplyEnv(); err != nil {
 		return nil, err
 	}
 	return &config, nil
 }
+
+// LoadConfig reads the configuration like ReadConfig, then applies the given overrides, such as
+// command-line settings, and validates the result. Invalid settings are all reported at once
+// in a *ValidationError.
+func LoadConfig(configFile string, overrides ...func(*AppConfig) error) (*AppConfig, error) {
+	config, err := ReadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		if err := override(config); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.ValidateConfig(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileNames(t *testing.T) {
+	cfg := validConfig()
+	cfg.InputFileName = InputFiles{"a.json", "b/*.json"}
+	cfg.ManifestFileName = "out/{run}.json"
+	expected := []FileName{{"inputFileName", "a.json"}, {"inputFileName", "b/*.json"}, {"outputFileName", "output.csv"}, {"manifestFileName", "out/{run}.json"}}
+	if names := cfg.FileNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	copied := cfg
+	copied.MapFileNames(strings.ToUpper)
+	if copied.InputFileName[1] != "B/*.JSON" || copied.OutputFileName != "OUTPUT.CSV" || copied.ManifestFileName != "OUT/{RUN}.JSON" || copied.DeadLetterFileName != "" {
+		t.Errorf("Unexpected mapped configuration %+v", copied)
+	}
+	if cfg.InputFileName[1] != "b/*.json" {
+		t.Error("MapFileNames changed the inputs of the original configuration")
+	}
+}
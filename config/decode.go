@@ -0,0 +1,320 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration file formats, selected by file extension. Files with other extensions are read as JSON.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// ErrUnknownSetting is returned for keys of a configuration file that match no setting, such as typos
+var ErrUnknownSetting = errors.New("unknown setting")
+
+// fileFormat returns the format of a configuration file from its extension
+func fileFormat(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatJSON
+}
+
+// position is a line and column in a configuration file, both starting at 1
+type position struct {
+	line   int
+	column int
+}
+
+func (p position) String() string {
+	return fmt.Sprintf("%d:%d", p.line, p.column)
+}
+
+// offsetPosition converts a byte offset into a position
+func offsetPosition(data []byte, offset int64) position {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	return position{line: line, column: len(before) - bytes.LastIndexByte(before, '\n')}
+}
+
+// keySchema lists the keys allowed in a configuration object. Keys holding objects, or arrays of objects,
+// map to the schema of those objects, other keys map to nil.
+type keySchema map[string]keySchema
+
+// schemaOf derives the allowed keys from the json tags of a struct type
+func schemaOf(structType reflect.Type) keySchema {
+	schema := keySchema{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Slice {
+			fieldType = fieldType.Elem()
+		}
+		var child keySchema
+		if fieldType.Kind() == reflect.Struct {
+			child = schemaOf(fieldType)
+		}
+		schema[name] = child
+	}
+	return schema
+}
+
+// unknownKeys collects the keys of a configuration file that match no setting
+type unknownKeys struct {
+	fileName string
+	errs     []error
+}
+
+func (u *unknownKeys) check(schema keySchema, path, key string, pos position) (keySchema, bool) {
+	child, ok := schema[key]
+	if !ok {
+		u.errs = append(u.errs, fmt.Errorf("%s:%s: %w %q", u.fileName, pos, ErrUnknownSetting, path+key))
+	}
+	return child, ok
+}
+
+func (u *unknownKeys) err() error {
+	return errors.Join(u.errs...)
+}
+
+// decodeConfig decodes a configuration file into config, rejecting keys that match no setting, then
+// expands the environment variables referenced by its string values, see expandEnv.
+// YAML and TOML documents are converted to JSON so the json tags and unmarshalers of AppConfig apply to every format.
+func decodeConfig(fileName string, data []byte, config *AppConfig) error {
+	configType := reflect.TypeOf(AppConfig{})
+	schema := schemaOf(configType)
+	unknown := &unknownKeys{fileName: fileName}
+	env := &envInterpolation{fileName: fileName}
+
+	switch fileFormat(fileName) {
+	case FormatYAML:
+		var document yaml.Node
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+		if len(document.Content) == 0 {
+			return nil
+		}
+		unknown.checkYAML(schema, "", document.Content[0])
+		if err := unknown.err(); err != nil {
+			return err
+		}
+		if env.yaml(&document); env.err() != nil {
+			return env.err()
+		}
+		var values map[string]any
+		if err := document.Decode(&values); err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+		return decodeValues(fileName, values, config)
+
+	case FormatTOML:
+		unknown.checkTOML(schema, data)
+		if err := unknown.err(); err != nil {
+			return err
+		}
+		var values map[string]any
+		if err := toml.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+		if env.toml(data, values, configType); env.err() != nil {
+			return env.err()
+		}
+		return decodeValues(fileName, values, config)
+	}
+
+	if err := unknown.checkJSON(schema, data); err != nil {
+		return jsonError(fileName, data, err)
+	}
+	if err := unknown.err(); err != nil {
+		return err
+	}
+	if data = env.json(data, configType); env.err() != nil {
+		return env.err()
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return jsonError(fileName, data, err)
+	}
+	return nil
+}
+
+// decodeValues decodes a generic YAML or TOML document through JSON
+func decodeValues(fileName string, values map[string]any, config *AppConfig) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fileName, err)
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("%s: %s: cannot use a %s as %s", fileName, typeErr.Field, typeErr.Value, typeErr.Type)
+		}
+		return fmt.Errorf("%s: %w", fileName, err)
+	}
+	return nil
+}
+
+// jsonError adds the position of JSON syntax and type errors
+func jsonError(fileName string, data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%s:%s: %w", fileName, offsetPosition(data, syntaxErr.Offset), err)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("%s:%s: %s: cannot use a %s as %s", fileName, offsetPosition(data, typeErr.Offset), typeErr.Field, typeErr.Value, typeErr.Type)
+	}
+	return fmt.Errorf("%s: %w", fileName, err)
+}
+
+func (u *unknownKeys) checkYAML(schema keySchema, path string, node *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			child, ok := u.check(schema, path, key.Value, position{line: key.Line, column: key.Column})
+			if ok && child != nil {
+				u.checkYAML(child, path+key.Value+".", value)
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			u.checkYAML(schema, path, item)
+		}
+	}
+}
+
+// checkJSON walks the tokens of a JSON document, a syntax error is returned as is
+func (u *unknownKeys) checkJSON(schema keySchema, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var walk func(schema keySchema, path string) error
+	walk = func(schema keySchema, path string) error {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'):
+			for decoder.More() {
+				// The key starts after the whitespace and separator following the previous token
+				start := decoder.InputOffset()
+				for start < int64(len(data)) && strings.IndexByte(" \t\r\n,{", data[start]) >= 0 {
+					start++
+				}
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				key, _ := keyToken.(string)
+				child, ok := u.check(schema, path, key, offsetPosition(data, start))
+				if !ok || child == nil {
+					if err := skipJSONValue(decoder); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := walk(child, path+key+"."); err != nil {
+					return err
+				}
+			}
+			_, err = decoder.Token()
+			return err
+		case json.Delim('['):
+			for decoder.More() {
+				if err := walk(schema, path); err != nil {
+					return err
+				}
+			}
+			_, err = decoder.Token()
+			return err
+		}
+		return nil
+	}
+	if err := walk(schema, ""); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func skipJSONValue(decoder *json.Decoder) error {
+	var value json.RawMessage
+	return decoder.Decode(&value)
+}
+
+func (u *unknownKeys) checkTOML(schema keySchema, data []byte) {
+	var parser unstable.Parser
+	parser.Reset(data)
+	table, tablePath := schema, ""
+	for parser.NextExpression() {
+		expression := parser.Expression()
+		switch expression.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table, tablePath = u.checkTOMLKey(&parser, schema, "", expression.Key())
+		case unstable.KeyValue:
+			if table != nil {
+				u.checkTOMLKeyValue(&parser, table, tablePath, expression)
+			}
+		}
+	}
+	// Syntax errors are reported by the decoder
+}
+
+// checkTOMLKey checks a possibly dotted key and returns the schema and path of the table it names
+func (u *unknownKeys) checkTOMLKey(parser *unstable.Parser, schema keySchema, path string, key unstable.Iterator) (keySchema, string) {
+	for key.Next() {
+		part := key.Node()
+		start := parser.Shape(part.Raw).Start
+		child, ok := u.check(schema, path, string(part.Data), position{line: start.Line, column: start.Column})
+		if !ok {
+			return nil, path
+		}
+		schema, path = child, path+string(part.Data)+"."
+	}
+	return schema, path
+}
+
+func (u *unknownKeys) checkTOMLKeyValue(parser *unstable.Parser, schema keySchema, path string, keyValue *unstable.Node) {
+	child, childPath := u.checkTOMLKey(parser, schema, path, keyValue.Key())
+	if child != nil {
+		u.checkTOMLValue(parser, child, childPath, keyValue.Value())
+	}
+}
+
+func (u *unknownKeys) checkTOMLValue(parser *unstable.Parser, schema keySchema, path string, value *unstable.Node) {
+	switch value.Kind {
+	case unstable.InlineTable:
+		children := value.Children()
+		for children.Next() {
+			u.checkTOMLKeyValue(parser, schema, path, children.Node())
+		}
+	case unstable.Array:
+		items := value.Children()
+		for items.Next() {
+			u.checkTOMLValue(parser, schema, path, items.Node())
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDecodeConfigFormats(t *testing.T) {
+	expected := AppConfig{
+		InputFileName:  InputFiles{"a.json", "b.json"},
+		OutputFileName: "out-{run}.csv",
+		NumWorkers:     4,
+		PreserveOrder:  true,
+		Columns:        []ColumnConfig{{Source: "spins", Type: "int"}, {Source: "meta.server_time", Name: "time", Type: "string", Required: true}},
+	}
+	for name, content := range map[string]string{
+		"app.json": `{
+  "inputFileName": ["a.json", "b.json"],
+  "outputFileName": "out-{run}.csv",
+  "numWorkers": 4,
+  "preserveOrder": true,
+  "columns": [{"source": "spins", "type": "int"}, {"source": "meta.server_time", "name": "time", "type": "string", "required": true}]
+}`,
+		"app.yaml": `inputFileName: [a.json, b.json]
+outputFileName: out-{run}.csv
+numWorkers: 4
+preserveOrder: true
+columns:
+  - source: spins
+    type: int
+  - {source: meta.server_time, name: time, type: string, required: true}
+`,
+		"app.toml": `inputFileName = ["a.json", "b.json"]
+outputFileName = "out-{run}.csv"
+numWorkers = 4
+preserveOrder = true
+
+[[columns]]
+source = "spins"
+type = "int"
+
+[[columns]]
+source = "meta.server_time"
+name = "time"
+type = "string"
+required = true
+`,
+	} {
+		var cfg AppConfig
+		data := []byte(content)
+		if err := decodeConfig(name, data, &cfg); err != nil {
+			t.Fatalf("%s: decodeConfig failed: %v", name, err)
+		}
+		if !reflect.DeepEqual(cfg, expected) {
+			t.Errorf("%s: expected %+v, got %+v", name, expected, cfg)
+		}
+	}
+}
+
+func TestDecodeConfigUnknownKeys(t *testing.T) {
+	for name, test := range map[string]struct {
+		content  string
+		expected []string
+	}{
+		"app.json": {
+			content: "{\n  \"numWorker\": 4,\n  \"columns\": [{\"source\": \"spins\", \"typ\": \"int\"}]\n}",
+			expected: []string{
+				`app.json:2:3: unknown setting "numWorker"`,
+				`app.json:3:35: unknown setting "columns.typ"`,
+			},
+		},
+		"app.yml": {
+			content: "numWorker: 4\ncolumns:\n  - source: spins\n    typ: int\n",
+			expected: []string{
+				`app.yml:1:1: unknown setting "numWorker"`,
+				`app.yml:4:5: unknown setting "columns.typ"`,
+			},
+		},
+		"app.toml": {
+			content: "numWorker = 4\ncolumns = [{source = \"spins\", typ = \"int\"}]\n[[columns]]\n  nam = \"x\"\n[output]\nformat = \"csv\"\n",
+			expected: []string{
+				`app.toml:1:1: unknown setting "numWorker"`,
+				`app.toml:2:31: unknown setting "columns.typ"`,
+				`app.toml:4:3: unknown setting "columns.nam"`,
+				`app.toml:5:2: unknown setting "output"`,
+			},
+		},
+	} {
+		var cfg AppConfig
+		err := decodeConfig(name, []byte(test.content), &cfg)
+		if !errors.Is(err, ErrUnknownSetting) {
+			t.Fatalf("%s: expected ErrUnknownSetting, got %v", name, err)
+		}
+		if messages := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(messages, test.expected) {
+			t.Errorf("%s: expected %q, got %q", name, test.expected, messages)
+		}
+	}
+}
+
+func TestDecodeConfigErrorPositions(t *testing.T) {
+	var cfg AppConfig
+	err := decodeConfig("app.json", []byte("{\n  \"linesPerFile\": \"four\"\n}"), &cfg)
+	if err == nil || !strings.HasPrefix(err.Error(), "app.json:2:") || !strings.Contains(err.Error(), "linesPerFile") {
+		t.Errorf("Expected a positioned type error, got %v", err)
+	}
+	err = decodeConfig("app.json", []byte("{\n  \"numWorkers\": 4\n  \"linesPerFile\": 10\n}"), &cfg)
+	if err == nil || !strings.HasPrefix(err.Error(), "app.json:3:") {
+		t.Errorf("Expected a positioned syntax error, got %v", err)
+	}
+}
+
+func TestDecodeConfigInterpolation(t *testing.T) {
+	t.Setenv("DATA_DIR", "/data")
+	t.Setenv("EMPTY", "")
+
+	var cfg AppConfig
+	content := `inputFileName: ${DATA_DIR}/input.json
+outputFileName: ${OUTPUT_DIR:-out}/${EMPTY:-rows}-$${run}.csv
+partitionKey: ${EMPTY:-}
+`
+	if err := decodeConfig("app.yaml", []byte(content), &cfg); err != nil {
+		t.Fatalf("decodeConfig failed: %v", err)
+	}
+	if cfg.InputFileName.String() != "/data/input.json" || cfg.OutputFileName != "out/rows-${run}.csv" || cfg.PartitionKey != "" {
+		t.Errorf("Unexpected configuration %+v", cfg)
+	}
+
+	err := decodeConfig("app.toml", []byte("runId = \"x\"\noutputFileName = \"${OUTPUT_DIR}/out.csv\"\n"), &cfg)
+	if err == nil || err.Error() != "app.toml:2:18: environment variable OUTPUT_DIR is not set" {
+		t.Errorf("Expected the undefined variable to be reported, got %v", err)
+	}
+}
+
+func TestDecodeConfigInterpolatesValuesOnly(t *testing.T) {
+	t.Setenv("IN", `a", "numWorkers": 7, "outputFileName": "x`)
+	t.Setenv("WINDOWS_PATH", `C:\data\in.json`)
+	t.Setenv("WORKERS", "6")
+
+	for name, content := range map[string]string{
+		"app.json": `{"inputFileName": ["${WINDOWS_PATH}", "${IN}"], "outputFileName": "out.csv", "partitionKey": "${WORKERS}"}`,
+		"app.yaml": "# ${UNSET} in a comment\ninputFileName: ['${WINDOWS_PATH}', '${IN}']\noutputFileName: out.csv\npartitionKey: '${WORKERS}'\n",
+		"app.toml": "# ${UNSET} in a comment\ninputFileName = ['${WINDOWS_PATH}', \"${IN}\"]\noutputFileName = \"out.csv\"\npartitionKey = \"${WORKERS}\"\n",
+	} {
+		var cfg AppConfig
+		if err := decodeConfig(name, []byte(content), &cfg); err != nil {
+			t.Errorf("%s: decodeConfig failed: %v", name, err)
+			continue
+		}
+		expected := InputFiles{`C:\data\in.json`, `a", "numWorkers": 7, "outputFileName": "x`}
+		if !reflect.DeepEqual(cfg.InputFileName, expected) || cfg.OutputFileName != "out.csv" || cfg.NumWorkers != 0 || cfg.PartitionKey != "6" {
+			t.Errorf("%s: expected the values to be substituted verbatim, got %+v", name, cfg)
+		}
+	}
+
+	// Plain YAML scalars take the type of their value
+	var cfg AppConfig
+	if err := decodeConfig("app.yaml", []byte("numWorkers: ${WORKERS}\nlinesPerFile: ${LINES:-100}\n"), &cfg); err != nil || cfg.NumWorkers != 6 || cfg.LinesPerFile != 100 {
+		t.Errorf("Expected numbers, got %+v, %v", cfg, err)
+	}
+
+	err := decodeConfig("app.json", []byte("{\"inputFileName\": \"${UNSET}\",\n  \"outputFileName\": \"${UNSET}\"}"), &cfg)
+	expected := "app.json:1:19: environment variable UNSET is not set\napp.json:2:21: environment variable UNSET is not set"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected each reference at its own position, got %v", err)
+	}
+	err = decodeConfig("app.yaml", []byte("inputFileName: in.json\noutputFileName:\n  ${UNSET}/out.csv\n"), &cfg)
+	if err == nil || err.Error() != "app.yaml:3:3: environment variable UNSET is not set" {
+		t.Errorf("Expected the position of the YAML value, got %v", err)
+	}
+}
+
+func TestDecodeConfigCoercesExpandedValues(t *testing.T) {
+	t.Setenv("LINES", "500")
+	t.Setenv("PERCENT", "2.5")
+	t.Setenv("ORDER", "true")
+	t.Setenv("WORKERS", "auto")
+
+	for name, content := range map[string]string{
+		"app.json": `{"linesPerFile": "${LINES}", "maxMalformedLines": "${MALFORMED:-7}", "maxMalformedPercent": "${PERCENT}", "preserveOrder": "${ORDER}",
+			"numWorkers": "${WORKERS}", "partitionKey": "${LINES}", "columns": [{"source": "spins", "required": "${ORDER}"}]}`,
+		"app.toml": "linesPerFile = \"${LINES}\"\nmaxMalformedLines = \"${MALFORMED:-7}\"\nmaxMalformedPercent = \"${PERCENT}\"\npreserveOrder = \"${ORDER}\"\n" +
+			"numWorkers = \"${WORKERS}\"\npartitionKey = \"${LINES}\"\n[[columns]]\nsource = \"spins\"\nrequired = \"${ORDER}\"\n",
+	} {
+		var cfg AppConfig
+		if err := decodeConfig(name, []byte(content), &cfg); err != nil {
+			t.Errorf("%s: decodeConfig failed: %v", name, err)
+			continue
+		}
+		if cfg.LinesPerFile != 500 || cfg.MaxMalformedLines != 7 || cfg.MaxMalformedPercent != 2.5 || !cfg.PreserveOrder ||
+			cfg.NumWorkers != Auto || cfg.PartitionKey != "500" || len(cfg.Columns) != 1 || !cfg.Columns[0].Required {
+			t.Errorf("%s: expected the values to take the type of their setting, got %+v", name, cfg)
+		}
+	}
+
+	// A value that is not a number is reported by the decoding
+	var cfg AppConfig
+	if err := decodeConfig("app.json", []byte(`{"linesPerFile": "${ORDER}"}`), &cfg); err == nil || !strings.Contains(err.Error(), "app.json:1:24: linesPerFile: cannot use a string as int") {
+		t.Errorf("Expected a type error, got %v", err)
+	}
+	if err := decodeConfig("app.toml", []byte("linesPerFile = \"${ORDER}\"\n"), &cfg); err == nil || !strings.Contains(err.Error(), "linesPerFile: cannot use a string as int") {
+		t.Errorf("Expected a type error, got %v", err)
+	}
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	path := writeConfigFile(t, "app.yaml", "inputFileName: input.json\noutputFileName: out.csv\nnumWorkers: 2\nlinesPerFile: 10\nlinesChannelSize: 1\nresultsChannelSize: 1\n")
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.NumWorkers != 2 || cfg.LinesPerFile != 10 {
+		t.Errorf("Unexpected configuration %+v", cfg)
+	}
+
+	path = writeConfigFile(t, "app.toml", "numWorkers = 2\nlinesPerFle = 10\n")
+	if _, err := LoadConfig(path); !errors.Is(err, ErrUnknownSetting) || !strings.Contains(err.Error(), path+":2:1:") {
+		t.Errorf("Expected the unknown setting to be reported with its position, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix starts the names of the environment variables overriding AppConfig settings
+const EnvPrefix = "EXTRACT_"
+
+// Field is an AppConfig setting as it is exposed outside the configuration file
+type Field struct {
+	Name    string // JSON key of the setting, also used as the flag name
+	EnvName string // Environment variable overriding the setting, e.g. EXTRACT_NUM_WORKERS for numWorkers
+	Usage   string
+	Type    string // Syntax of the value: string, int, number, bool, list or json
+	index   int
+}
+
+var inputFilesType = reflect.TypeOf(InputFiles(nil))
+
+// Fields lists the settings of AppConfig in declaration order, described by their json and usage tags
+func Fields() []Field {
+	configType := reflect.TypeOf(AppConfig{})
+	fields := make([]Field, 0, configType.NumField())
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, Field{
+			Name:    name,
+			EnvName: EnvPrefix + upperSnakeCase(name),
+			Usage:   field.Tag.Get("usage"),
+			Type:    valueType(field.Type),
+			index:   i,
+		})
+	}
+	return fields
+}
+
+// upperSnakeCase turns a camel case JSON key like maxBytesPerFile into MAX_BYTES_PER_FILE
+func upperSnakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+func valueType(t reflect.Type) string {
+	switch {
+	case t == inputFilesType:
+		return "list"
+	case t.Kind() == reflect.String:
+		return "string"
+	case t.Kind() == reflect.Int || t.Kind() == reflect.Int64:
+		return "int"
+	case t.Kind() == reflect.Float64:
+		return "number"
+	case t.Kind() == reflect.Bool:
+		return "bool"
+	}
+	return "json"
+}
+
+// Set parses value into the setting with the given JSON key. Lists are comma separated, and settings
+// that are not scalars, like columns, are given as JSON.
+func (c *AppConfig) Set(name, value string) error {
+	for _, field := range Fields() {
+		if field.Name == name {
+			return field.set(reflect.ValueOf(c).Elem().Field(field.index), value)
+		}
+	}
+	return fmt.Errorf("%w %q", ErrUnknownSetting, name)
+}
+
+// ApplyEnv overrides settings with the environment variables named by Fields. Empty variables are ignored.
+// All invalid values are reported together, each with the variable name.
+func (c *AppConfig) ApplyEnv() error {
+	var errs []error
+	for _, field := range Fields() {
+		value, ok := os.LookupEnv(field.EnvName)
+		if !ok || value == "" {
+			continue
+		}
+		if err := field.set(reflect.ValueOf(c).Elem().Field(field.index), value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.EnvName, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment override: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (f Field) set(v reflect.Value, value string) error {
+	invalid := func(err error) error {
+		var numErr *strconv.NumError
+		if errors.As(err, &numErr) {
+			err = numErr.Err
+		}
+		return fmt.Errorf("%s: invalid %s value %q: %w", f.Name, f.Type, value, err)
+	}
+	if unmarshaler, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := unmarshaler.UnmarshalText([]byte(value)); err != nil {
+			return invalid(err)
+		}
+		return nil
+	}
+	switch f.Type {
+	case "list":
+		var list InputFiles
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	case "string":
+		v.SetString(value)
+	case "int":
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, v.Type().Bits())
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetInt(n)
+	case "number":
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetFloat(n)
+	case "bool":
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetBool(b)
+	default:
+		target := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(value), target.Interface()); err != nil {
+			return invalid(err)
+		}
+		v.Set(target.Elem())
+	}
+	return nil
+}
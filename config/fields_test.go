@@ -0,0 +1,109 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFieldsCoverAppConfig(t *testing.T) {
+	fields := Fields()
+	if len(fields) != reflect.TypeOf(AppConfig{}).NumField() {
+		t.Fatalf("Expected a field per AppConfig setting, got %d", len(fields))
+	}
+	for _, field := range fields {
+		if field.Usage == "" {
+			t.Errorf("Setting %s has no usage", field.Name)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	var cfg AppConfig
+	for name, value := range map[string]string{
+		"inputFileName":       "a.json, shards/*.json",
+		"numWorkers":          "8",
+		"linesChannelSize":    "auto",
+		"maxMalformedLines":   "100",
+		"maxMalformedPercent": "2.5",
+		"preserveOrder":       "true",
+		"outputFormat":        "ndjson",
+		"columns":             `[{"source": "spins", "type": "int"}]`,
+	} {
+		if err := cfg.Set(name, value); err != nil {
+			t.Fatalf("Set(%s, %q) failed: %v", name, value, err)
+		}
+	}
+	expected := AppConfig{
+		InputFileName:       InputFiles{"a.json", "shards/*.json"},
+		NumWorkers:          8,
+		LinesChannelSize:    Auto,
+		MaxMalformedLines:   100,
+		MaxMalformedPercent: 2.5,
+		PreserveOrder:       true,
+		OutputFormat:        "ndjson",
+		Columns:             []ColumnConfig{{Source: "spins", Type: "int"}},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, cfg)
+	}
+}
+
+func TestSetInvalidValue(t *testing.T) {
+	var cfg AppConfig
+	for name, value := range map[string]string{
+		"numWorkers":    "four",
+		"linesPerFile":  "99999999999999999999",
+		"preserveOrder": "maybe",
+		"columns":       "spins",
+		"unknown":       "1",
+	} {
+		err := cfg.Set(name, value)
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected an error naming %s for %q, got %v", name, value, err)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("EXTRACT_NUM_WORKERS", "6")
+	t.Setenv("EXTRACT_INPUT_FILE_NAME", "shards/")
+	t.Setenv("EXTRACT_MAX_BYTES_PER_FILE", "1048576")
+	t.Setenv("EXTRACT_OUTPUT_FORMAT", "")
+
+	cfg := AppConfig{NumWorkers: 2, OutputFormat: "tsv"}
+	if err := cfg.ApplyEnv(); err != nil {
+		t.Fatalf("ApplyEnv failed: %v", err)
+	}
+	if cfg.NumWorkers != 6 || cfg.InputFileName.String() != "shards/" || cfg.MaxBytesPerFile != 1<<20 || cfg.OutputFormat != "tsv" {
+		t.Errorf("Unexpected configuration %+v", cfg)
+	}
+
+	t.Setenv("EXTRACT_LINES_PER_FILE", "many")
+	t.Setenv("EXTRACT_PRESERVE_ORDER", "yes please")
+	err := cfg.ApplyEnv()
+	if err == nil || !strings.Contains(err.Error(), "EXTRACT_LINES_PER_FILE") || !strings.Contains(err.Error(), "EXTRACT_PRESERVE_ORDER") {
+		t.Errorf("Expected both invalid variables to be reported, got %v", err)
+	}
+}
+
+func TestAutoInt(t *testing.T) {
+	var cfg AppConfig
+	if err := json.Unmarshal([]byte(`{"numWorkers": "auto", "linesChannelSize": 64, "resultsChannelSize": "AUTO"}`), &cfg); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if cfg.NumWorkers != Auto || cfg.LinesChannelSize != 64 || cfg.ResultsChannelSize != Auto {
+		t.Errorf("Unexpected sizes %v, %v, %v", cfg.NumWorkers, cfg.LinesChannelSize, cfg.ResultsChannelSize)
+	}
+	data, err := json.Marshal(struct{ A, B AutoInt }{Auto, 8})
+	if err != nil || string(data) != `{"A":"auto","B":8}` {
+		t.Errorf("Unexpected JSON %s, %v", data, err)
+	}
+	if err := json.Unmarshal([]byte(`{"numWorkers": "many"}`), &cfg); err == nil {
+		t.Error("Expected an invalid size to be rejected")
+	}
+	if err := cfg.Set("numWorkers", "many"); err == nil || !strings.Contains(err.Error(), `"auto"`) {
+		t.Errorf("Expected the error to mention auto, got %v", err)
+	}
+}
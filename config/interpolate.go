@@ -0,0 +1,259 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+var envReference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv replaces ${NAME} with the value of the environment variable NAME, and ${NAME:-default} with
+// default when NAME is unset or empty. "$${" escapes a literal "${". It returns the names of the variables
+// that are not set and have no default, their references are left as they are.
+func expandEnv(value string) (string, []string) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		if reference == "$${" {
+			return "${"
+		}
+		match := envReference.FindStringSubmatch(reference)
+		if value := os.Getenv(match[1]); value != "" {
+			return value
+		}
+		if strings.Contains(reference, ":-") {
+			return match[2]
+		}
+		missing = append(missing, match[1])
+		return reference
+	})
+	return expanded, missing
+}
+
+// envInterpolation expands the references of the string values of a parsed configuration file. Keys,
+// comments and other values are left alone, so a variable can neither add settings nor break the syntax.
+type envInterpolation struct {
+	fileName string
+	errs     []error
+}
+
+// expand expands a string value found at pos, recording the variables that are not set
+func (e *envInterpolation) expand(value string, pos position) string {
+	expanded, missing := expandEnv(value)
+	for _, name := range missing {
+		e.errs = append(e.errs, fmt.Errorf("%s:%s: environment variable %s is not set", e.fileName, pos, name))
+	}
+	return expanded
+}
+
+func (e *envInterpolation) err() error {
+	return errors.Join(e.errs...)
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// fieldType returns the type of the field of a struct type with the given json key, nil when there is none
+func fieldType(structType reflect.Type, key string) reflect.Type {
+	if structType == nil || structType.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name == key {
+			return field.Type
+		}
+	}
+	return nil
+}
+
+// elemType returns the type of the elements of a slice type, nil for other types
+func elemType(sliceType reflect.Type) reflect.Type {
+	if sliceType == nil || sliceType.Kind() != reflect.Slice {
+		return nil
+	}
+	return sliceType.Elem()
+}
+
+// coerce converts an expanded string to the number or boolean of an int, float or bool setting, as
+// JSON and TOML can only hold a reference in a string. Settings with their own unmarshaler, like AutoInt,
+// and values that do not parse are left as strings, the decoding reports the latter.
+func coerce(valueType reflect.Type, value string) (any, bool) {
+	if valueType == nil || reflect.PointerTo(valueType).Implements(unmarshalerType) {
+		return nil, false
+	}
+	var coerced any
+	var err error
+	switch valueType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		coerced, err = strconv.ParseInt(value, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		coerced, err = strconv.ParseUint(value, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		coerced, err = strconv.ParseFloat(value, 64)
+	case reflect.Bool:
+		coerced, err = strconv.ParseBool(value)
+	default:
+		return nil, false
+	}
+	return coerced, err == nil
+}
+
+// yaml expands the string scalars of a YAML document, except mapping keys. Plain scalars are resolved again
+// once expanded, so `numWorkers: ${WORKERS}` gives a number, quoted ones stay strings.
+func (e *envInterpolation) yaml(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			e.yaml(child)
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			e.yaml(node.Content[i])
+		}
+	case yaml.ScalarNode:
+		if node.ShortTag() != "!!str" || !strings.Contains(node.Value, "${") {
+			return
+		}
+		node.Value = e.expand(node.Value, position{line: node.Line, column: node.Column})
+		if node.Style == 0 {
+			node.Tag = ""
+		}
+	}
+}
+
+// toml expands the string values of a decoded TOML document, decoded into a value of configType. The
+// document is parsed again to report unset variables at the position of their value.
+func (e *envInterpolation) toml(data []byte, values map[string]any, configType reflect.Type) {
+	var parser unstable.Parser
+	parser.Reset(data)
+	var check func(value *unstable.Node)
+	check = func(value *unstable.Node) {
+		switch value.Kind {
+		case unstable.String:
+			start := parser.Shape(value.Raw).Start
+			e.expand(string(value.Data), position{line: start.Line, column: start.Column})
+		case unstable.Array, unstable.InlineTable:
+			children := value.Children()
+			for children.Next() {
+				child := children.Node()
+				if child.Kind == unstable.KeyValue {
+					child = child.Value()
+				}
+				check(child)
+			}
+		}
+	}
+	for parser.NextExpression() {
+		if expression := parser.Expression(); expression.Kind == unstable.KeyValue {
+			check(expression.Value())
+		}
+	}
+
+	var expand func(value any, valueType reflect.Type) any
+	expand = func(value any, valueType reflect.Type) any {
+		switch value := value.(type) {
+		case string:
+			if !strings.Contains(value, "${") {
+				return value
+			}
+			expanded, _ := expandEnv(value)
+			if coerced, ok := coerce(valueType, expanded); ok {
+				return coerced
+			}
+			return expanded
+		case map[string]any:
+			for key, child := range value {
+				value[key] = expand(child, fieldType(valueType, key))
+			}
+		case []any:
+			for i, child := range value {
+				value[i] = expand(child, elemType(valueType))
+			}
+		}
+		return value
+	}
+	expand(values, configType)
+}
+
+// jsonContainer is an object or an array enclosing a value of a JSON document
+type jsonContainer struct {
+	object    bool
+	valueType reflect.Type // Type the container is decoded into, nil when unknown
+	key       string       // Key of the current value of an object
+}
+
+// json expands the string values of a JSON document decoded into a value of configType, except object keys,
+// and returns the document with the expanded values encoded in place of the original ones. Syntax errors
+// are left to the decoding.
+func (e *envInterpolation) json(data []byte, configType reflect.Type) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var expanded bytes.Buffer
+	var copied int64
+	var containers []jsonContainer
+	// valueType returns the type of the current value, configType outside of any container
+	valueType := func() reflect.Type {
+		if len(containers) == 0 {
+			return configType
+		}
+		container := containers[len(containers)-1]
+		if container.object {
+			return fieldType(container.valueType, container.key)
+		}
+		return elemType(container.valueType)
+	}
+	expectKey := false
+	for {
+		// The token starts after the whitespace and separator following the previous one
+		start := decoder.InputOffset()
+		for start < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[start]) >= 0 {
+			start++
+		}
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch token := token.(type) {
+		case json.Delim:
+			if token == '{' || token == '[' {
+				containers = append(containers, jsonContainer{object: token == '{', valueType: valueType()})
+				expectKey = token == '{'
+				continue
+			}
+			containers = containers[:len(containers)-1]
+		case string:
+			if expectKey {
+				containers[len(containers)-1].key = token
+				expectKey = false
+				continue
+			}
+			if value := e.expand(token, offsetPosition(data, start)); value != token {
+				encoded, _ := json.Marshal(value)
+				if coerced, ok := coerce(valueType(), value); ok {
+					encoded, _ = json.Marshal(coerced)
+				}
+				expanded.Write(data[copied:start])
+				expanded.Write(encoded)
+				copied = decoder.InputOffset()
+			}
+		}
+		// A value ended, a key follows inside an object
+		expectKey = len(containers) > 0 && containers[len(containers)-1].object
+	}
+	if copied == 0 {
+		return data
+	}
+	expanded.Write(data[copied:])
+	return expanded.Bytes()
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxWorkers bounds numWorkers, far above any useful count, so a typo cannot start millions of goroutines
+	MaxWorkers = 1024
+	// MaxChannelSize bounds the channel and reorder buffer sizes, which hold lines in flight in memory
+	MaxChannelSize = 1 << 20
+)
+
+var (
+	ErrInvalidWorkerCount       = fmt.Errorf("worker count must be between 1 and %d, or auto", MaxWorkers)
+	ErrInvalidChannelSize       = fmt.Errorf("channel size must be between 1 and %d", MaxChannelSize)
+	ErrInvalidLinesPerFile      = errors.New("lines per file must be greater than 0")
+	ErrInvalidInputFileName     = errors.New("input file name cannot be empty")
+	ErrInvalidOutputFileName    = errors.New("output file name cannot be empty")
+	ErrInvalidOutputFormat      = errors.New("output format must be one of csv, tsv, ndjson or parquet")
+	ErrInvalidMalformedLimit    = errors.New("malformed line limits must be positive and the percentage cannot exceed 100")
+	ErrInvalidCheckpoint        = errors.New("resume requires a checkpoint file and checkpointEvery cannot be negative")
+	ErrInvalidMaxLineSize       = errors.New("max line size must be positive, 0 for the default or -1 for no limit")
+	ErrInvalidCompression       = errors.New("input compression must be one of auto, none, gzip, zstd, bzip2 or xz")
+	ErrInvalidOutputCompression = errors.New("output compression must be one of none, gzip (level 1-9) or zstd (level 1-22)")
+	ErrInvalidMaxBytesPerFile   = errors.New("max bytes per file cannot be negative")
+	ErrInvalidInputParallelism  = errors.New("input parallelism cannot be negative, and files read in parallel cannot preserve order or be checkpointed")
+	ErrInvalidStdio             = errors.New("standard input or output (\"-\") cannot be checkpointed, and standard output cannot be rotated by size or have a manifest")
+	ErrInvalidColumn            = errors.New("columns must have a source and a type of string, int, float or bool")
+)
+
+// FieldError is a setting with an invalid value, it wraps one of the ErrInvalid* errors
+type FieldError struct {
+	Field string // JSON key of the setting, e.g. "numWorkers" or "columns[2].type"
+	Value any
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s=%#v: %v", e.Field, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError lists every invalid setting of a configuration.
+// errors.Is matches it against the ErrInvalid* error of any of its settings.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return "invalid configuration: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// ValidateConfig validates the application configuration. It checks every setting and returns
+// a *ValidationError listing all the invalid ones, or nil.
+func (c *AppConfig) ValidateConfig() error {
+	var errs []*FieldError
+	invalid := func(field string, value any, err error) {
+		errs = append(errs, &FieldError{Field: field, Value: value, Err: err})
+	}
+
+	if !c.NumWorkers.within(MaxWorkers) {
+		invalid("numWorkers", c.NumWorkers, ErrInvalidWorkerCount)
+	}
+
+	if !c.LinesChannelSize.within(MaxChannelSize) {
+		invalid("linesChannelSize", c.LinesChannelSize, ErrInvalidChannelSize)
+	}
+
+	if !c.ResultsChannelSize.within(MaxChannelSize) {
+		invalid("resultsChannelSize", c.ResultsChannelSize, ErrInvalidChannelSize)
+	}
+
+	if c.LinesPerFile <= 0 {
+		invalid("linesPerFile", c.LinesPerFile, ErrInvalidLinesPerFile)
+	}
+
+	if len(c.InputFileName) == 0 {
+		invalid("inputFileName", c.InputFileName.String(), ErrInvalidInputFileName)
+	}
+
+	if c.OutputFileName == "" {
+		invalid("outputFileName", c.OutputFileName, ErrInvalidOutputFileName)
+	}
+
+	switch c.OutputFormat {
+	case "", "csv", "tsv", "ndjson", "parquet":
+	default:
+		invalid("outputFormat", c.OutputFormat, ErrInvalidOutputFormat)
+	}
+
+	if c.InputParallelism < 0 || (c.InputParallelism > 1 && (c.PreserveOrder || c.CheckpointFileName != "")) {
+		invalid("inputParallelism", c.InputParallelism, ErrInvalidInputParallelism)
+	}
+
+	if c.ReorderBufferSize < 0 || c.ReorderBufferSize > MaxChannelSize {
+		invalid("reorderBufferSize", c.ReorderBufferSize, ErrInvalidChannelSize)
+	}
+
+	if c.OutputFileName == "-" && (c.CheckpointFileName != "" || c.MaxBytesPerFile > 0 || c.ManifestFileName != "") {
+		invalid("outputFileName", c.OutputFileName, ErrInvalidStdio)
+	}
+	for _, input := range c.InputFileName {
+		if input == "-" && c.CheckpointFileName != "" {
+			invalid("inputFileName", input, ErrInvalidStdio)
+		}
+	}
+
+	if c.CheckpointEvery < 0 {
+		invalid("checkpointEvery", c.CheckpointEvery, ErrInvalidCheckpoint)
+	}
+	if c.Resume && c.CheckpointFileName == "" {
+		invalid("checkpointFileName", c.CheckpointFileName, ErrInvalidCheckpoint)
+	}
+
+	switch c.InputCompression {
+	case "", "auto", "none", "gzip", "zstd", "bzip2", "xz":
+	default:
+		invalid("inputCompression", c.InputCompression, ErrInvalidCompression)
+	}
+
+	switch c.OutputCompression {
+	case "", "none":
+	case "gzip":
+		if c.OutputCompressionLevel < 0 || c.OutputCompressionLevel > 9 {
+			invalid("outputCompressionLevel", c.OutputCompressionLevel, ErrInvalidOutputCompression)
+		}
+	case "zstd":
+		if c.OutputCompressionLevel < 0 || c.OutputCompressionLevel > 22 {
+			invalid("outputCompressionLevel", c.OutputCompressionLevel, ErrInvalidOutputCompression)
+		}
+	default:
+		invalid("outputCompression", c.OutputCompression, ErrInvalidOutputCompression)
+	}
+
+	if c.MaxBytesPerFile < 0 {
+		invalid("maxBytesPerFile", c.MaxBytesPerFile, ErrInvalidMaxBytesPerFile)
+	}
+
+	if c.MaxLineSize < -1 {
+		invalid("maxLineSize", c.MaxLineSize, ErrInvalidMaxLineSize)
+	}
+
+	if c.MaxMalformedLines < 0 {
+		invalid("maxMalformedLines", c.MaxMalformedLines, ErrInvalidMalformedLimit)
+	}
+	if c.MaxMalformedPercent < 0 || c.MaxMalformedPercent > 100 {
+		invalid("maxMalformedPercent", c.MaxMalformedPercent, ErrInvalidMalformedLimit)
+	}
+
+	for i, column := range c.Columns {
+		if column.Source == "" {
+			invalid(fmt.Sprintf("columns[%d].source", i), column.Source, ErrInvalidColumn)
+		}
+		switch column.Type {
+		case "", "string", "int", "float", "bool":
+		default:
+			invalid(fmt.Sprintf("columns[%d].type", i), column.Type, ErrInvalidColumn)
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func validConfig() AppConfig {
+	return AppConfig{
+		InputFileName:      InputFiles{"input.json"},
+		OutputFileName:     "output.csv",
+		NumWorkers:         2,
+		LinesPerFile:       100,
+		LinesChannelSize:   10,
+		ResultsChannelSize: 10,
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	cfg := validConfig()
+	if err := cfg.ValidateConfig(); err != nil {
+		t.Fatalf("Expected a valid configuration, got %v", err)
+	}
+	cfg.NumWorkers, cfg.LinesChannelSize, cfg.ResultsChannelSize = Auto, Auto, Auto
+	if err := cfg.ValidateConfig(); err != nil {
+		t.Fatalf("Expected auto sizes to be valid, got %v", err)
+	}
+	cfg.NumWorkers = -2
+	if err := cfg.ValidateConfig(); !errors.Is(err, ErrInvalidWorkerCount) {
+		t.Errorf("Expected a negative worker count to be rejected, got %v", err)
+	}
+}
+
+func TestValidateConfigBoundsSizes(t *testing.T) {
+	for _, set := range []func(*AppConfig){
+		func(c *AppConfig) { c.NumWorkers = MaxWorkers + 1 },
+		func(c *AppConfig) { c.LinesChannelSize = 1 << 40 },
+		func(c *AppConfig) { c.ResultsChannelSize = MaxChannelSize + 1 },
+		func(c *AppConfig) { c.ReorderBufferSize = MaxChannelSize + 1 },
+	} {
+		cfg := validConfig()
+		set(&cfg)
+		var validationErr *ValidationError
+		if err := cfg.ValidateConfig(); !errors.As(err, &validationErr) || len(validationErr.Errors) != 1 {
+			t.Errorf("Expected the oversized setting to be rejected, got %v", err)
+		}
+	}
+	cfg := validConfig()
+	cfg.NumWorkers, cfg.LinesChannelSize = MaxWorkers, MaxChannelSize
+	if err := cfg.ValidateConfig(); err != nil {
+		t.Errorf("Expected the maximums to be valid, got %v", err)
+	}
+}
+
+func TestValidateConfigReportsAllViolations(t *testing.T) {
+	cfg := validConfig()
+	cfg.NumWorkers = 0
+	cfg.OutputFormat = "xml"
+	cfg.MaxMalformedPercent = 150
+	cfg.Columns = []ColumnConfig{{Source: "spins", Type: "int"}, {Source: "", Type: "date"}}
+
+	err := cfg.ValidateConfig()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	expected := []string{
+		`numWorkers=0: `,
+		`outputFormat="xml": `,
+		`maxMalformedPercent=150: `,
+		`columns[1].source="": `,
+		`columns[1].type="date": `,
+	}
+	if len(validationErr.Errors) != len(expected) {
+		t.Fatalf("Expected %d violations, got %v", len(expected), err)
+	}
+	for i, prefix := range expected {
+		if message := validationErr.Errors[i].Error(); !strings.HasPrefix(message, prefix) {
+			t.Errorf("Expected violation %d to start with %q, got %q", i, prefix, message)
+		}
+	}
+	for _, sentinel := range []error{ErrInvalidWorkerCount, ErrInvalidOutputFormat, ErrInvalidMalformedLimit, ErrInvalidColumn} {
+		if !errors.Is(err, sentinel) {
+			t.Errorf("Expected the error to match %v", sentinel)
+		}
+	}
+}
+
+func TestLoadConfigValidates(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(configFile, []byte(`{"inputFileName": "input.json", "outputFileName": "output.csv", "numWorkers": 2}`), 0644)
+
+	if _, err := LoadConfig(configFile); !errors.Is(err, ErrInvalidLinesPerFile) || !errors.Is(err, ErrInvalidChannelSize) {
+		t.Errorf("Expected the missing sizes to be reported, got %v", err)
+	}
+
+	// Overrides are applied before validation
+	cfg, err := LoadConfig(configFile, func(cfg *AppConfig) error {
+		cfg.LinesPerFile, cfg.LinesChannelSize, cfg.ResultsChannelSize = 100, 10, 10
+		return nil
+	})
+	if err != nil || cfg.NumWorkers != 2 || cfg.LinesPerFile != 100 {
+		t.Errorf("Expected a valid configuration, got %+v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,160 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	jobsBucket      = []byte("jobs")      // Job ID to the job in JSON
+	indexBucket     = []byte("index")     // Job key to the job ID, see jobKey
+	schedulesBucket = []byte("schedules") // Schedule ID to the schedule in JSON
+)
+
+// BoltStore keeps the jobs and the schedules in a single bbolt database file, so the job history and the
+// schedules survive restarts. Every job is kept.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens the database at path, creating it and its directory if needed.
+// It fails when another process holds the database for more than a second.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("creating the job store directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening the job store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, indexBucket, schedulesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing the job store %s: %w", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Save(job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(jobsBucket).Put([]byte(job.ID), data); err != nil {
+			return err
+		}
+		return tx.Bucket(indexBucket).Put(jobKey(job), []byte(job.ID))
+	})
+}
+
+func (s *BoltStore) Get(id string) (Job, error) {
+	var job Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrJobNotFound
+		}
+		return json.Unmarshal(data, &job)
+	})
+	return job, err
+}
+
+func (s *BoltStore) List(query Query) ([]Job, string, error) {
+	if err := query.validate(); err != nil {
+		return nil, "", err
+	}
+	after, _ := query.cursorKey()
+	jobs := []Job{}
+	next := ""
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket)
+		c := tx.Bucket(indexBucket).Cursor()
+		key, id := c.First()
+		if len(after) != 0 {
+			key, id = c.Seek(after)
+		}
+		if !query.From.IsZero() {
+			// Keys start with the submission time, the jobs before From are skipped
+			if from := jobKey(Job{CreatedAt: query.From}); bytes.Compare(from, key) > 0 {
+				key, id = c.Seek(from)
+			}
+		}
+		for ; key != nil; key, id = c.Next() {
+			if bytes.Equal(key, after) {
+				continue
+			}
+			var job Job
+			if err := json.Unmarshal(data.Get(id), &job); err != nil {
+				return fmt.Errorf("decoding job %s: %w", id, err)
+			}
+			if !query.To.IsZero() && !job.CreatedAt.Before(query.To) {
+				break
+			}
+			if !query.matches(job) {
+				continue
+			}
+			if len(jobs) == query.Limit {
+				next = cursor(jobKey(jobs[len(jobs)-1]))
+				break
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return jobs, next, nil
+}
+
+func (s *BoltStore) SaveSchedule(schedule Schedule) error {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).Put([]byte(schedule.ID), data)
+	})
+}
+
+func (s *BoltStore) DeleteSchedule(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).Delete([]byte(id))
+	})
+}
+
+func (s *BoltStore) Schedules() ([]Schedule, error) {
+	schedules := []Schedule{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).ForEach(func(id, data []byte) error {
+			var schedule Schedule
+			if err := json.Unmarshal(data, &schedule); err != nil {
+				return fmt.Errorf("decoding schedule %s: %w", id, err)
+			}
+			schedules = append(schedules, schedule)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"assignment/config"
+	"assignment/internal/service"
+	"assignment/pkg/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxRequestBody bounds the size of a submitted job configuration
+const maxRequestBody = 1 << 20
+
+// Handler serves the job API:
+//
+//	POST   /jobs       submit an extraction, the body is an AppConfig in JSON
+//	GET    /jobs       list the jobs, filtered by ?status=, ?from= and ?to=, a page of ?limit= at a time
+//	GET    /jobs/{id}  get a job
+//	DELETE /jobs/{id}  cancel a job
+//
+//	POST   /schedules       add a schedule, the body is a Schedule in JSON
+//	GET    /schedules       list the schedules
+//	GET    /schedules/{id}  get a schedule with its missed runs
+//	DELETE /schedules/{id}  remove a schedule
+//
+// A job list carries the cursor of the next page in "next", passed back as ?cursor=.
+type Handler struct {
+	pool      *Pool
+	scheduler *Scheduler
+	defaults  config.AppConfig
+	mux       *http.ServeMux
+}
+
+// NewHandler serves the jobs of pool and the schedules of scheduler. Settings missing from a submitted
+// configuration or schedule template are taken from defaults.
+func NewHandler(pool *Pool, scheduler *Scheduler, defaults config.AppConfig) *Handler {
+	h := &Handler{pool: pool, scheduler: scheduler, defaults: defaults, mux: http.NewServeMux()}
+	h.mux.HandleFunc("POST /jobs", h.submit)
+	h.mux.HandleFunc("GET /jobs", h.list)
+	h.mux.HandleFunc("GET /jobs/{id}", h.get)
+	h.mux.HandleFunc("DELETE /jobs/{id}", h.cancel)
+	h.mux.HandleFunc("POST /schedules", h.addSchedule)
+	h.mux.HandleFunc("GET /schedules", h.listSchedules)
+	h.mux.HandleFunc("GET /schedules/{id}", h.getSchedule)
+	h.mux.HandleFunc("DELETE /schedules/{id}", h.removeSchedule)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) submit(w http.ResponseWriter, r *http.Request) {
+	cfg := h.defaultConfig()
+	if err := decodeBody(w, r, &cfg); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid job configuration: %w", err))
+		return
+	}
+
+	job, err := h.pool.Submit(&cfg)
+	switch {
+	case isInvalidConfig(err):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, ErrQueueFull), errors.Is(err, ErrPoolClosed):
+		writeError(w, http.StatusServiceUnavailable, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	jobs, next, err := h.pool.List(query)
+	switch {
+	case errors.Is(err, ErrInvalidQuery):
+		writeError(w, http.StatusBadRequest, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, struct {
+			Jobs []Job  `json:"jobs"`
+			Next string `json:"next,omitempty"`
+		}{Jobs: jobs, Next: next})
+	}
+}
+
+// parseQuery reads the status, from, to, limit and cursor parameters of GET /jobs.
+// Dates are RFC 3339 timestamps or plain days, in UTC.
+func parseQuery(values url.Values) (Query, error) {
+	query := Query{Status: Status(values.Get("status")), Cursor: values.Get("cursor")}
+	for _, date := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &query.From}, {"to", &query.To}} {
+		if s := values.Get(date.name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				if t, err = time.Parse(time.DateOnly, s); err != nil {
+					return Query{}, fmt.Errorf("%w: %s must be an RFC 3339 timestamp or a date, got %q", ErrInvalidQuery, date.name, s)
+				}
+			}
+			*date.value = t
+		}
+	}
+	if s := values.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil {
+			return Query{}, fmt.Errorf("%w: limit must be a number, got %q", ErrInvalidQuery, s)
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	job, err := h.pool.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (h *Handler) cancel(w http.ResponseWriter, r *http.Request) {
+	job, err := h.pool.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrJobFinished):
+		writeError(w, http.StatusConflict, err)
+	default:
+		// A running job stops asynchronously, its status changes once the output is flushed
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func (h *Handler) addSchedule(w http.ResponseWriter, r *http.Request) {
+	spec := Schedule{Config: h.defaultConfig()}
+	if err := decodeBody(w, r, &spec); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid schedule: %w", err))
+		return
+	}
+
+	schedule, err := h.scheduler.Add(spec)
+	switch {
+	case errors.Is(err, ErrInvalidSchedule), isInvalidConfig(err):
+		writeError(w, http.StatusBadRequest, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		w.Header().Set("Location", "/schedules/"+schedule.ID)
+		writeJSON(w, http.StatusCreated, schedule)
+	}
+}
+
+func (h *Handler) listSchedules(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		Schedules []Schedule `json:"schedules"`
+	}{Schedules: h.scheduler.List()})
+}
+
+func (h *Handler) getSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := h.scheduler.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+func (h *Handler) removeSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := h.scheduler.Remove(r.PathValue("id")); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// defaultConfig returns a copy of the defaults to decode a request over, the slices are cloned so the
+// request cannot change them
+func (h *Handler) defaultConfig() config.AppConfig {
+	cfg := h.defaults
+	cfg.InputFileName = slices.Clone(cfg.InputFileName)
+	cfg.Columns = slices.Clone(cfg.Columns)
+	return cfg
+}
+
+// decodeBody decodes a JSON request body, rejecting unknown keys
+func decodeBody(w http.ResponseWriter, r *http.Request, value any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(value)
+}
+
+// isInvalidConfig reports whether a job configuration was rejected
+func isInvalidConfig(err error) bool {
+	var validationErr *config.ValidationError
+	return errors.As(err, &validationErr) || errors.Is(err, service.ErrInvalidConfig)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.Warning("Failed to write response", logrus.Fields{"error": err})
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
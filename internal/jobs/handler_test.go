@@ -0,0 +1,175 @@
+package jobs
+
+import (
+	"assignment/config"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func request(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return recorder
+}
+
+func decodeJob(t *testing.T, recorder *httptest.ResponseRecorder) Job {
+	t.Helper()
+	var job Job
+	if err := json.NewDecoder(recorder.Body).Decode(&job); err != nil {
+		t.Fatalf("Failed to decode job: %v", err)
+	}
+	return job
+}
+
+func TestHandlerJobLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	pool, _ := NewPool(1, 4, nil, dir)
+	defer pool.Shutdown(context.Background())
+	// The defaults supply everything but the input and output files
+	defaults := *testConfig("", "")
+	defaults.InputFileName = nil
+	handler := NewHandler(pool, nil, defaults)
+
+	body := `{"inputFileName": "` + writeInput(t, dir, 10) + `", "outputFileName": "` + filepath.Join(dir, "output.csv") + `"}`
+	recorder := request(t, handler, http.MethodPost, "/jobs", body)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", recorder.Code, recorder.Body)
+	}
+	job := decodeJob(t, recorder)
+	if location := recorder.Header().Get("Location"); location != "/jobs/"+job.ID {
+		t.Errorf("Unexpected location %q", location)
+	}
+	if job.Config.NumWorkers != 2 || job.Config.LinesPerFile != 100 {
+		t.Errorf("Expected the defaults to be applied, got %+v", job.Config)
+	}
+	waitFor(t, pool, job.ID, StatusSucceeded)
+
+	recorder = request(t, handler, http.MethodGet, "/jobs/"+job.ID, "")
+	if job = decodeJob(t, recorder); recorder.Code != http.StatusOK || job.Result == nil || job.Result.Stats.LinesWritten != 10 {
+		t.Errorf("Unexpected job %d %+v", recorder.Code, job)
+	}
+
+	recorder = request(t, handler, http.MethodGet, "/jobs", "")
+	var list struct {
+		Jobs []Job `json:"jobs"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&list); err != nil || len(list.Jobs) != 1 || list.Jobs[0].ID != job.ID {
+		t.Errorf("Unexpected job list %+v, %v", list, err)
+	}
+
+	if recorder = request(t, handler, http.MethodDelete, "/jobs/"+job.ID, ""); recorder.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when cancelling a finished job, got %d", recorder.Code)
+	}
+	if defaults.Columns != nil || defaults.InputFileName != nil {
+		t.Error("The request changed the defaults")
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	pool, _ := NewPool(1, 1, nil, ".")
+	defer pool.Shutdown(context.Background())
+	scheduler, _ := NewScheduler(pool)
+	defer scheduler.Stop()
+	handler := NewHandler(pool, scheduler, config.AppConfig{})
+
+	for _, test := range []struct {
+		method, path, body string
+		status             int
+		message            string
+	}{
+		{http.MethodPost, "/jobs", `{"numWorker": 2}`, http.StatusBadRequest, "unknown field"},
+		{http.MethodPost, "/jobs", `{"numWorkers": `, http.StatusBadRequest, "invalid job configuration"},
+		{http.MethodPost, "/jobs", `{"numWorkers": 2}`, http.StatusBadRequest, "invalid configuration: "},
+		{http.MethodPost, "/jobs", `{"inputFileName": "in.json", "outputFileName": "out.csv", "numWorkers": 1, "linesPerFile": 1, "linesChannelSize": 1099511627776, "resultsChannelSize": 1}`, http.StatusBadRequest, "linesChannelSize=1099511627776"},
+		{http.MethodPost, "/jobs", `{"inputFileName": "-", "outputFileName": "../out.csv", "numWorkers": 1, "linesPerFile": 1, "linesChannelSize": 1, "resultsChannelSize": 1}`, http.StatusBadRequest, `inputFileName=\"-\": jobs cannot read standard input`},
+		{http.MethodGet, "/jobs/unknown", "", http.StatusNotFound, "job not found"},
+		{http.MethodDelete, "/jobs/unknown", "", http.StatusNotFound, "job not found"},
+		{http.MethodPut, "/jobs", "", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/jobs?status=done", "", http.StatusBadRequest, "unknown status"},
+		{http.MethodGet, "/jobs?limit=ten", "", http.StatusBadRequest, "limit must be a number"},
+		{http.MethodGet, "/jobs?from=yesterday", "", http.StatusBadRequest, "from must be an RFC 3339 timestamp or a date"},
+		{http.MethodGet, "/jobs?cursor=zz", "", http.StatusBadRequest, "invalid cursor"},
+		{http.MethodPost, "/schedules", `{"cron": "@hourly", "config": {"numWorker": 2}}`, http.StatusBadRequest, "unknown field"},
+		{http.MethodPost, "/schedules", `{"cron": "every hour"}`, http.StatusBadRequest, "invalid schedule: cron expression"},
+		{http.MethodPost, "/schedules", `{"cron": "@hourly"}`, http.StatusBadRequest, "invalid configuration: "},
+		{http.MethodGet, "/schedules/unknown", "", http.StatusNotFound, "schedule not found"},
+		{http.MethodDelete, "/schedules/unknown", "", http.StatusNotFound, "schedule not found"},
+	} {
+		recorder := request(t, handler, test.method, test.path, test.body)
+		if recorder.Code != test.status || !strings.Contains(recorder.Body.String(), test.message) {
+			t.Errorf("%s %s %s: expected %d with %q, got %d: %s", test.method, test.path, test.body, test.status, test.message, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestHandlerListPages(t *testing.T) {
+	store := NewMemoryStore()
+	jobs := saveJobs(t, store, 5)
+	pool, _ := NewPool(1, 1, store, ".")
+	defer pool.Shutdown(context.Background())
+	handler := NewHandler(pool, nil, config.AppConfig{})
+
+	var list struct {
+		Jobs []Job  `json:"jobs"`
+		Next string `json:"next"`
+	}
+	path := "/jobs?status=succeeded&from=2025-05-24T01:00:00Z&to=2025-05-25&limit=2"
+	recorder := request(t, handler, http.MethodGet, path, "")
+	if err := json.NewDecoder(recorder.Body).Decode(&list); err != nil || len(list.Jobs) != 2 || list.Jobs[0].ID != jobs[1].ID || list.Next == "" {
+		t.Fatalf("Unexpected first page %+v, %v", list, err)
+	}
+	recorder = request(t, handler, http.MethodGet, path+"&cursor="+list.Next, "")
+	list.Next = ""
+	if err := json.NewDecoder(recorder.Body).Decode(&list); err != nil || len(list.Jobs) != 1 || list.Jobs[0].ID != jobs[4].ID || list.Next != "" {
+		t.Errorf("Unexpected last page %+v, %v", list, err)
+	}
+}
+
+func TestHandlerSchedules(t *testing.T) {
+	pool, _ := NewPool(1, 1, nil, ".")
+	defer pool.Shutdown(context.Background())
+	scheduler, _ := NewScheduler(pool)
+	defer scheduler.Stop()
+	defaults := *testConfig("", "")
+	defaults.InputFileName = nil
+	handler := NewHandler(pool, scheduler, defaults)
+
+	body := `{"name": "spins", "cron": "0 * * * *", "offset": "-1h", "config": {"inputFileName": "shards/{date}/{hour}.json", "outputFileName": "out/{date}-{hour}.csv"}}`
+	recorder := request(t, handler, http.MethodPost, "/schedules", body)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", recorder.Code, recorder.Body)
+	}
+	var schedule Schedule
+	if err := json.NewDecoder(recorder.Body).Decode(&schedule); err != nil {
+		t.Fatalf("Failed to decode schedule: %v", err)
+	}
+	if location := recorder.Header().Get("Location"); location != "/schedules/"+schedule.ID {
+		t.Errorf("Unexpected location %q", location)
+	}
+	if schedule.Config.NumWorkers != 2 || schedule.Config.OutputFileName != "out/{date}-{hour}.csv" || schedule.NextRun.IsZero() {
+		t.Errorf("Unexpected schedule %+v", schedule)
+	}
+
+	recorder = request(t, handler, http.MethodGet, "/schedules", "")
+	var list struct {
+		Schedules []Schedule `json:"schedules"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&list); err != nil || len(list.Schedules) != 1 || list.Schedules[0].ID != schedule.ID {
+		t.Errorf("Unexpected schedule list %+v, %v", list, err)
+	}
+	if recorder = request(t, handler, http.MethodGet, "/schedules/"+schedule.ID, ""); recorder.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", recorder.Code)
+	}
+	if recorder = request(t, handler, http.MethodDelete, "/schedules/"+schedule.ID, ""); recorder.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", recorder.Code)
+	}
+	if len(scheduler.List()) != 0 {
+		t.Error("Expected the schedule to be removed")
+	}
+}
@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"assignment/config"
+	"assignment/internal/service"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// MaxJobWorkers and MaxJobChannelSize bound the jobs of the pool, below the limits of config.ValidateConfig,
+	// as several jobs share the memory of the service
+	MaxJobWorkers     = 64
+	MaxJobChannelSize = 65536
+)
+
+var (
+	ErrOutsideDataRoot = errors.New("file must be inside the data root of the service")
+	ErrJobStdio        = errors.New("jobs cannot read standard input or write standard output")
+	ErrJobSize         = fmt.Errorf("jobs are limited to %d workers and %d lines per channel or reorder buffer", MaxJobWorkers, MaxJobChannelSize)
+	ErrJobFileNamePart = errors.New("cannot hold a path, it is substituted into file names")
+)
+
+// checkJob rejects the settings a job submitted over the API must not use: files outside the data root,
+// standard input or output, and sizes holding too much memory. Violations are returned as a
+// *config.ValidationError, like those of ValidateConfig.
+func checkJob(cfg *config.AppConfig, dataRoot string) error {
+	var errs []*config.FieldError
+	invalid := func(field string, value any, err error) {
+		errs = append(errs, &config.FieldError{Field: field, Value: value, Err: err})
+	}
+
+	for _, file := range cfg.FileNames() {
+		switch {
+		case file.Name == service.StdioFileName:
+			invalid(file.Field, file.Name, ErrJobStdio)
+		case !insideDir(dataRoot, file.Name):
+			invalid(file.Field, file.Name, ErrOutsideDataRoot)
+		}
+	}
+	// {run} and {partition} are expanded after the file names are checked
+	for _, part := range []config.FileName{{Field: "runId", Name: cfg.RunID}, {Field: "partitionKey", Name: cfg.PartitionKey}} {
+		if strings.ContainsAny(part.Name, `/\`) || strings.Contains(part.Name, "..") {
+			invalid(part.Field, part.Name, ErrJobFileNamePart)
+		}
+	}
+
+	if cfg.NumWorkers > MaxJobWorkers {
+		invalid("numWorkers", cfg.NumWorkers, ErrJobSize)
+	}
+	if cfg.LinesChannelSize > MaxJobChannelSize {
+		invalid("linesChannelSize", cfg.LinesChannelSize, ErrJobSize)
+	}
+	if cfg.ResultsChannelSize > MaxJobChannelSize {
+		invalid("resultsChannelSize", cfg.ResultsChannelSize, ErrJobSize)
+	}
+	if cfg.ReorderBufferSize > MaxJobChannelSize {
+		invalid("reorderBufferSize", cfg.ReorderBufferSize, ErrJobSize)
+	}
+
+	if len(errs) > 0 {
+		return &config.ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// insideDir reports whether a file name, relative to the working directory or absolute, lies inside dir,
+// an absolute path. The check is lexical: symbolic links inside dir are trusted.
+func insideDir(dir, name string) bool {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"assignment/config"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckJob(t *testing.T) {
+	root := t.TempDir()
+	inside := func(name string) string { return filepath.Join(root, name) }
+	cfg := testConfig(inside("shards/*.json"), inside("out/{date}/spins-{index}.csv"))
+	cfg.DeadLetterFileName, cfg.ManifestFileName = inside("rejected.ndjson"), inside("out/{run}.manifest.json")
+	if err := checkJob(cfg, root); err != nil {
+		t.Fatalf("Expected the job to be accepted, got %v", err)
+	}
+
+	for _, test := range []struct {
+		set   func(*config.AppConfig)
+		field string
+		err   error
+	}{
+		{func(c *config.AppConfig) { c.InputFileName = config.InputFiles{inside("a.json"), "-"} }, "inputFileName", ErrJobStdio},
+		{func(c *config.AppConfig) { c.OutputFileName = "-" }, "outputFileName", ErrJobStdio},
+		{func(c *config.AppConfig) { c.InputFileName[0] = "/etc/passwd" }, "inputFileName", ErrOutsideDataRoot},
+		{func(c *config.AppConfig) { c.OutputFileName = inside("../out.csv") }, "outputFileName", ErrOutsideDataRoot},
+		{func(c *config.AppConfig) { c.DeadLetterFileName = filepath.Dir(root) }, "deadLetterFileName", ErrOutsideDataRoot},
+		{func(c *config.AppConfig) { c.CheckpointFileName = "checkpoint.json" }, "checkpointFileName", ErrOutsideDataRoot},
+		{func(c *config.AppConfig) { c.ManifestFileName = inside("a/../../b.json") }, "manifestFileName", ErrOutsideDataRoot},
+		{func(c *config.AppConfig) { c.RunID = "../../etc" }, "runId", ErrJobFileNamePart},
+		{func(c *config.AppConfig) { c.PartitionKey = `a\b` }, "partitionKey", ErrJobFileNamePart},
+		{func(c *config.AppConfig) { c.NumWorkers = MaxJobWorkers + 1 }, "numWorkers", ErrJobSize},
+		{func(c *config.AppConfig) { c.ResultsChannelSize = MaxJobChannelSize + 1 }, "resultsChannelSize", ErrJobSize},
+		{func(c *config.AppConfig) { c.ReorderBufferSize = MaxJobChannelSize + 1 }, "reorderBufferSize", ErrJobSize},
+	} {
+		cfg := testConfig(inside("input.json"), inside("output.csv"))
+		test.set(cfg)
+		err := checkJob(cfg, root)
+		var validationErr *config.ValidationError
+		if !errors.As(err, &validationErr) || len(validationErr.Errors) != 1 || validationErr.Errors[0].Field != test.field || !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.field, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Package jobs runs extractions submitted at runtime or on a schedule in a bounded pool of workers
+package jobs
+
+import (
+	"assignment/config"
+	"assignment/internal/service"
+	"assignment/pkg/logger"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+	ErrQueueFull   = errors.New("job queue is full")
+	ErrPoolClosed  = errors.New("job pool is shutting down")
+)
+
+// Status is the state of a job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Finished reports whether the job has stopped for good
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCancelled
+}
+
+// Job is an extraction submitted to the pool. The copies returned by the pool are snapshots.
+type Job struct {
+	ID         string                    `json:"id"`
+	Status     Status                    `json:"status"`
+	Config     config.AppConfig          `json:"config"`
+	CreatedAt  time.Time                 `json:"createdAt"`
+	StartedAt  *time.Time                `json:"startedAt,omitempty"`
+	FinishedAt *time.Time                `json:"finishedAt,omitempty"`
+	Result     *service.ExtractionResult `json:"result,omitempty"` // Also set for failed and cancelled runs that got started
+	Error      string                    `json:"error,omitempty"`
+}
+
+// extractor runs the extraction of a job, it is a *service.ExtractionManager outside of tests
+type extractor interface {
+	Extract(ctx context.Context) (*service.ExtractionResult, error)
+}
+
+// job is the state of a Job inside the pool, guarded by the pool mutex
+type job struct {
+	Job
+	manager extractor
+	cancel  context.CancelFunc // Cancels the running extraction, nil unless running
+}
+
+// Pool runs jobs with a fixed number of workers. Jobs wait in a bounded queue until a worker is free.
+// Every change of a job is saved to the store, which answers the queries.
+type Pool struct {
+	mu       sync.Mutex
+	jobs     map[string]*job // Queued and running jobs
+	store    Store
+	dataRoot string // Absolute directory holding every file of the jobs
+	queue    chan *job
+	closed   bool
+	ctx      context.Context // Cancelled on shutdown, stops the running jobs
+	stop     context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewPool starts numWorkers workers, running jobs one at a time each, with up to queueSize jobs waiting.
+// Jobs only read and write files inside dataRoot. A nil store selects a MemoryStore. Jobs the store still
+// lists as queued or running were stopped by a restart of the service, they are marked as failed.
+// The caller closes the store after Shutdown.
+func NewPool(numWorkers, queueSize int, store Store, dataRoot string) (*Pool, error) {
+	if numWorkers <= 0 || queueSize < 0 {
+		return nil, fmt.Errorf("%w: the pool needs at least one worker and the queue size cannot be negative", service.ErrInvalidConfig)
+	}
+	if dataRoot == "" {
+		return nil, fmt.Errorf("%w: the pool needs a data root", service.ErrInvalidConfig)
+	}
+	dataRoot, err := filepath.Abs(dataRoot)
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	if err := failInterruptedJobs(store); err != nil {
+		return nil, err
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	p := &Pool{
+		jobs:     make(map[string]*job),
+		store:    store,
+		dataRoot: dataRoot,
+		queue:    make(chan *job, queueSize),
+		ctx:      ctx,
+		stop:     stop,
+	}
+	for i := 0; i < numWorkers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+	return p, nil
+}
+
+// Submit validates the configuration and queues an extraction. Invalid configurations, and those breaking
+// the limits of jobs, see checkJob, are rejected with a *config.ValidationError or service.ErrInvalidConfig.
+// ErrQueueFull is returned when no slot is free.
+func (p *Pool) Submit(cfg *config.AppConfig) (Job, error) {
+	manager, err := newManager(cfg, p.dataRoot)
+	if err != nil {
+		return Job{}, err
+	}
+	return p.enqueue(cfg, manager)
+}
+
+// Validate checks a job configuration like Submit does, without queueing it
+func (p *Pool) Validate(cfg *config.AppConfig) error {
+	_, err := newManager(cfg, p.dataRoot)
+	return err
+}
+
+// newManager validates the configuration and builds the extraction of a job, it does not touch the files
+func newManager(cfg *config.AppConfig, dataRoot string) (*service.ExtractionManager, error) {
+	if err := cfg.ValidateConfig(); err != nil {
+		return nil, err
+	}
+	if err := checkJob(cfg, dataRoot); err != nil {
+		return nil, err
+	}
+	return service.NewExtractionManager(
+		cfg.InputFileName.String(),
+		cfg.OutputFileName,
+		int(cfg.NumWorkers),
+		cfg.LinesPerFile,
+		int(cfg.LinesChannelSize),
+		int(cfg.ResultsChannelSize),
+		service.ConfigOptions(cfg)...,
+	)
+}
+
+// enqueue queues the extraction of a validated configuration
+func (p *Pool) enqueue(cfg *config.AppConfig, manager extractor) (Job, error) {
+	j := &job{
+		Job:     Job{ID: newJobID(), Status: StatusQueued, Config: *cfg, CreatedAt: time.Now().UTC()},
+		manager: manager,
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return Job{}, ErrPoolClosed
+	}
+	select {
+	case p.queue <- j:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	// No worker can take the job before the mutex is released
+	if err := p.store.Save(j.Job); err != nil {
+		j.Status = StatusFailed
+		return Job{}, fmt.Errorf("saving the job: %w", err)
+	}
+	p.jobs[j.ID] = j
+	logger.Info("Job queued", logrus.Fields{"jobId": j.ID})
+	return j.Job, nil
+}
+
+// Get returns the job with the given ID
+func (p *Pool) Get(id string) (Job, error) {
+	return p.store.Get(id)
+}
+
+// List returns a page of the jobs matching the query, in submission order, and the cursor of the next page
+func (p *Pool) List(query Query) ([]Job, string, error) {
+	return p.store.List(query)
+}
+
+// Cancel stops a job. A queued job is cancelled right away, a running one once its extraction has flushed
+// the lines already read, see service.ExtractionManager.Extract.
+func (p *Pool) Cancel(id string) (Job, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	j, ok := p.jobs[id]
+	if !ok {
+		// Only unfinished jobs are kept by the pool
+		job, err := p.store.Get(id)
+		if err != nil {
+			return Job{}, err
+		}
+		return job, ErrJobFinished
+	}
+	switch {
+	case j.Status == StatusQueued:
+		p.finish(j, StatusCancelled, nil, context.Canceled)
+	case j.cancel != nil:
+		j.cancel()
+	}
+	return j.Job, nil
+}
+
+// Accepting returns ErrPoolClosed once the pool is shutting down, for health checks
+func (p *Pool) Accepting() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	return nil
+}
+
+// Shutdown stops accepting jobs, cancels the queued and running ones and waits for the workers to stop,
+// or for ctx to be done
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	p.stop()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+	for j := range p.queue {
+		p.run(j)
+	}
+}
+
+// run executes a queued job, unless it was cancelled while waiting
+func (p *Pool) run(j *job) {
+	p.mu.Lock()
+	if j.Status != StatusQueued {
+		p.mu.Unlock()
+		return
+	}
+	if p.ctx.Err() != nil {
+		p.finish(j, StatusCancelled, nil, p.ctx.Err())
+		p.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+	started := time.Now().UTC()
+	j.Status, j.StartedAt, j.cancel = StatusRunning, &started, cancel
+	manager := j.manager
+	p.save(j)
+	p.mu.Unlock()
+
+	logger.Info("Job started", logrus.Fields{"jobId": j.ID})
+	result, err := manager.Extract(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	j.cancel = nil
+	switch {
+	case err == nil:
+		p.finish(j, StatusSucceeded, result, nil)
+	case errors.Is(err, context.Canceled):
+		p.finish(j, StatusCancelled, result, err)
+	default:
+		p.finish(j, StatusFailed, result, err)
+	}
+}
+
+// finish records the outcome of a job, the pool mutex must be held
+func (p *Pool) finish(j *job, status Status, result *service.ExtractionResult, err error) {
+	finished := time.Now().UTC()
+	j.Status, j.FinishedAt, j.Result = status, &finished, result
+	j.manager = nil
+	if err != nil {
+		j.Error = err.Error()
+	}
+	logger.Info("Job finished", logrus.Fields{"jobId": j.ID, "status": status, "error": j.Error})
+	p.save(j)
+	delete(p.jobs, j.ID)
+}
+
+// save records the state of a job. A job keeps running when its state cannot be saved, the failure is logged.
+func (p *Pool) save(j *job) {
+	if err := p.store.Save(j.Job); err != nil {
+		logger.Error("Failed to save job", logrus.Fields{"jobId": j.ID, "status": j.Status, "error": err})
+	}
+}
+
+// failInterruptedJobs marks the jobs a previous process left queued or running as failed
+func failInterruptedJobs(store Store) error {
+	for _, status := range []Status{StatusQueued, StatusRunning} {
+		for {
+			// Failed jobs no longer match the query, so the first page is read until it is empty
+			jobs, _, err := store.List(Query{Status: status, Limit: MaxPageSize})
+			if err != nil {
+				return err
+			}
+			if len(jobs) == 0 {
+				break
+			}
+			for _, job := range jobs {
+				finished := time.Now().UTC()
+				job.Status, job.FinishedAt, job.Error = StatusFailed, &finished, "interrupted by a restart of the service"
+				if err := store.Save(job); err != nil {
+					return err
+				}
+				logger.Warning("Job interrupted by a restart", logrus.Fields{"jobId": job.ID})
+			}
+		}
+	}
+	return nil
+}
+
+func newJobID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,202 @@
+package jobs
+
+import (
+	"assignment/config"
+	"assignment/internal/service"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// blockingExtractor runs until it is released or its context is cancelled
+type blockingExtractor struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingExtractor() *blockingExtractor {
+	return &blockingExtractor{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (e *blockingExtractor) Extract(ctx context.Context) (*service.ExtractionResult, error) {
+	close(e.started)
+	select {
+	case <-e.release:
+		return &service.ExtractionResult{RunID: "released"}, nil
+	case <-ctx.Done():
+		return &service.ExtractionResult{RunID: "cancelled", Interrupted: true}, ctx.Err()
+	}
+}
+
+func writeInput(t *testing.T, dir string, numLines int) string {
+	t.Helper()
+	fileName := filepath.Join(dir, "input.json")
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for i := 0; i < numLines; i++ {
+		fmt.Fprintf(file, `{"spins": %d, "server_time": "2025-05-24 00:00:00 UTC"}`+"\n", i)
+	}
+	return fileName
+}
+
+func testConfig(inputFileName, outputFileName string) *config.AppConfig {
+	return &config.AppConfig{
+		InputFileName:      config.InputFiles{inputFileName},
+		OutputFileName:     outputFileName,
+		NumWorkers:         2,
+		LinesPerFile:       100,
+		LinesChannelSize:   10,
+		ResultsChannelSize: 10,
+	}
+}
+
+// waitFor polls the job until it reaches the status
+func waitFor(t *testing.T, pool *Pool, id string, status Status) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := pool.Get(id)
+		if err != nil {
+			t.Fatalf("Get(%s) failed: %v", id, err)
+		}
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job %s is %s, expected %s", id, job.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPoolRunsJobs(t *testing.T) {
+	dir := t.TempDir()
+	pool, err := NewPool(2, 4, nil, dir)
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer pool.Shutdown(context.Background())
+
+	job, err := pool.Submit(testConfig(writeInput(t, dir, 250), filepath.Join(dir, "output-{index}.csv")))
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	job = waitFor(t, pool, job.ID, StatusSucceeded)
+	if job.Result == nil || job.Result.Stats.LinesWritten != 250 || len(job.Result.OutputFiles) != 3 {
+		t.Errorf("Unexpected result %+v", job.Result)
+	}
+	if job.StartedAt == nil || job.FinishedAt == nil || job.Error != "" {
+		t.Errorf("Unexpected job %+v", job)
+	}
+
+	failed, err := pool.Submit(testConfig(filepath.Join(dir, "missing.json"), filepath.Join(dir, "missing.csv")))
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if failed = waitFor(t, pool, failed.ID, StatusFailed); failed.Error == "" {
+		t.Error("Expected the failure to be recorded")
+	}
+	if jobs, _, _ := pool.List(Query{}); len(jobs) != 2 || jobs[0].ID != job.ID || jobs[1].ID != failed.ID {
+		t.Errorf("Expected the jobs in submission order, got %+v", jobs)
+	}
+}
+
+func TestPoolRejectsInvalidConfig(t *testing.T) {
+	pool, _ := NewPool(1, 1, nil, ".")
+	defer pool.Shutdown(context.Background())
+
+	cfg := testConfig("input.json", "output.csv")
+	cfg.NumWorkers = 0
+	var validationErr *config.ValidationError
+	if _, err := pool.Submit(cfg); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+	cfg = testConfig("input.json", "output.csv")
+	cfg.OutputFormat, cfg.OutputCompression = "parquet", "gzip"
+	if _, err := pool.Submit(cfg); !errors.Is(err, service.ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+	if jobs, _, _ := pool.List(Query{}); len(jobs) != 0 {
+		t.Error("Expected rejected jobs not to be listed")
+	}
+}
+
+func TestPoolQueueAndCancel(t *testing.T) {
+	pool, _ := NewPool(1, 1, nil, ".")
+	defer pool.Shutdown(context.Background())
+	cfg := testConfig("input.json", "output.csv")
+
+	running := newBlockingExtractor()
+	first, _ := pool.enqueue(cfg, running)
+	<-running.started
+	queued := newBlockingExtractor()
+	second, err := pool.enqueue(cfg, queued)
+	if err != nil {
+		t.Fatalf("Expected the second job to be queued, got %v", err)
+	}
+	if _, err := pool.enqueue(cfg, newBlockingExtractor()); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+
+	// A queued job is cancelled right away and never runs
+	if job, err := pool.Cancel(second.ID); err != nil || job.Status != StatusCancelled {
+		t.Errorf("Expected the queued job to be cancelled, got %+v, %v", job, err)
+	}
+	// A running job stops once its extraction returns
+	if _, err := pool.Cancel(first.ID); err != nil {
+		t.Errorf("Cancel failed: %v", err)
+	}
+	job := waitFor(t, pool, first.ID, StatusCancelled)
+	if job.Result == nil || !job.Result.Interrupted {
+		t.Errorf("Expected the partial result to be kept, got %+v", job.Result)
+	}
+	if _, err := pool.Cancel(first.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Expected ErrJobFinished, got %v", err)
+	}
+	if _, err := pool.Cancel("unknown"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+
+	// The worker skips the cancelled job and takes the next one
+	next := newBlockingExtractor()
+	third, _ := pool.enqueue(cfg, next)
+	<-next.started
+	close(next.release)
+	waitFor(t, pool, third.ID, StatusSucceeded)
+	select {
+	case <-queued.started:
+		t.Error("The cancelled job was run")
+	default:
+	}
+}
+
+func TestPoolShutdown(t *testing.T) {
+	pool, _ := NewPool(1, 1, nil, ".")
+	cfg := testConfig("input.json", "output.csv")
+	running := newBlockingExtractor()
+	first, _ := pool.enqueue(cfg, running)
+	<-running.started
+	second, _ := pool.enqueue(cfg, newBlockingExtractor())
+
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	for _, id := range []string{first.ID, second.ID} {
+		if job, _ := pool.Get(id); job.Status != StatusCancelled {
+			t.Errorf("Expected job %s to be cancelled, got %s", id, job.Status)
+		}
+	}
+	if _, err := pool.Submit(cfg); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed, got %v", err)
+	}
+	if err := pool.Accepting(); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Expected the pool to report it is closed, got %v", err)
+	}
+}
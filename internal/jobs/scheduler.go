@@ -0,0 +1,324 @@
+package jobs
+
+import (
+	"assignment/config"
+	"assignment/internal/service"
+	"assignment/pkg/logger"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+	ErrInvalidSchedule  = errors.New("invalid schedule")
+)
+
+// MaxMissedRuns is the number of missed runs a schedule records, older ones are dropped
+const MaxMissedRuns = 100
+
+// idleWait is how long the scheduler sleeps when it has no schedule, adding one wakes it up
+const idleWait = time.Hour
+
+// Schedule submits a job built from a configuration template at every activation of a cron expression.
+// A run is skipped while the job of the previous one is still queued or running, and recorded as missed.
+type Schedule struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Cron is a 5 field cron expression or a descriptor such as @hourly, evaluated in UTC unless it starts
+	// with CRON_TZ=<zone>
+	Cron string `json:"cron"`
+	// Offset shifts the time substituted into the file name placeholders, "-1h" names the shard of the
+	// previous hour
+	Offset string `json:"offset,omitempty"`
+	// Config is the template of the jobs. The {date}, {hour}, {time} and {timestamp} placeholders of its
+	// file names are replaced by the scheduled time plus Offset.
+	Config      config.AppConfig `json:"config"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	NextRun     time.Time        `json:"nextRun"`
+	LastRun     *time.Time       `json:"lastRun,omitempty"`
+	LastJobID   string           `json:"lastJobId,omitempty"`
+	MissedCount int              `json:"missedCount"`
+	MissedRuns  []MissedRun      `json:"missedRuns,omitempty"` // The last MaxMissedRuns missed runs
+}
+
+// MissedRun is an activation of a schedule that submitted no job
+type MissedRun struct {
+	ScheduledAt time.Time `json:"scheduledAt"`
+	Reason      string    `json:"reason"`
+}
+
+// submitter is the part of the pool the scheduler uses, a *Pool outside of tests
+type submitter interface {
+	Submit(cfg *config.AppConfig) (Job, error)
+	Validate(cfg *config.AppConfig) error
+	Get(id string) (Job, error)
+}
+
+// schedule is the state of a Schedule inside the scheduler, guarded by the scheduler mutex
+type schedule struct {
+	Schedule
+	cron   cron.Schedule
+	offset time.Duration
+}
+
+// Scheduler submits the jobs of its schedules to a pool. Schedules are saved to the store of the pool, and
+// only outlive the process when the store is persistent.
+type Scheduler struct {
+	mu        sync.Mutex
+	pool      submitter
+	store     Store
+	schedules map[string]*schedule
+	now       func() time.Time
+	wake      chan struct{} // Signals a change of the schedules to the loop
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewScheduler starts a scheduler submitting its jobs to pool, with the schedules saved in the store of the
+// pool. Runs that fell due while the service was down are handled like those of a late wake up, see runDue.
+func NewScheduler(pool *Pool) (*Scheduler, error) {
+	return newScheduler(pool, pool.store, time.Now)
+}
+
+func newScheduler(pool submitter, store Store, now func() time.Time) (*Scheduler, error) {
+	s := &Scheduler{
+		pool:      pool,
+		store:     store,
+		schedules: make(map[string]*schedule),
+		now:       now,
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	saved, err := store.Schedules()
+	if err != nil {
+		return nil, fmt.Errorf("loading the schedules: %w", err)
+	}
+	for _, spec := range saved {
+		sc, err := newSchedule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("loading schedule %s: %w", spec.ID, err)
+		}
+		s.schedules[sc.ID] = sc
+	}
+	go s.loop()
+	return s, nil
+}
+
+// newSchedule parses the cron expression and the offset of a schedule
+func newSchedule(spec Schedule) (*schedule, error) {
+	expression, err := cron.ParseStandard(spec.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cron expression %q: %w", ErrInvalidSchedule, spec.Cron, err)
+	}
+	var offset time.Duration
+	if spec.Offset != "" {
+		if offset, err = time.ParseDuration(spec.Offset); err != nil {
+			return nil, fmt.Errorf("%w: offset %q: %w", ErrInvalidSchedule, spec.Offset, err)
+		}
+	}
+	return &schedule{Schedule: spec, cron: expression, offset: offset}, nil
+}
+
+// Add validates a schedule and starts it. Only Name, Cron, Offset and Config are taken from the argument.
+// Invalid expressions and offsets are rejected with ErrInvalidSchedule, and invalid templates like the
+// configurations of Pool.Submit.
+func (s *Scheduler) Add(spec Schedule) (Schedule, error) {
+	now := s.now().UTC()
+	sc, err := newSchedule(Schedule{
+		ID:        newJobID(),
+		Name:      spec.Name,
+		Cron:      spec.Cron,
+		Offset:    spec.Offset,
+		Config:    spec.Config,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return Schedule{}, err
+	}
+	sc.NextRun = sc.cron.Next(now)
+	// The template is checked as the job of the next run would be
+	cfg := sc.jobConfig(sc.NextRun)
+	if err := s.pool.Validate(&cfg); err != nil {
+		return Schedule{}, err
+	}
+
+	s.mu.Lock()
+	added := sc.snapshot()
+	if err := s.store.SaveSchedule(added); err != nil {
+		s.mu.Unlock()
+		return Schedule{}, fmt.Errorf("saving the schedule: %w", err)
+	}
+	s.schedules[sc.ID] = sc
+	s.mu.Unlock()
+	s.signal()
+	logger.Info("Schedule added", logrus.Fields{"scheduleId": added.ID, "cron": added.Cron, "nextRun": added.NextRun})
+	return added, nil
+}
+
+// Get returns the schedule with the given ID
+func (s *Scheduler) Get(id string) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, ErrScheduleNotFound
+	}
+	return sc.snapshot(), nil
+}
+
+// List returns the schedules in creation order
+func (s *Scheduler) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedules := make([]Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		schedules = append(schedules, sc.snapshot())
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		if !schedules[i].CreatedAt.Equal(schedules[j].CreatedAt) {
+			return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+		}
+		return schedules[i].ID < schedules[j].ID
+	})
+	return schedules
+}
+
+// Remove stops a schedule, the job of its last run keeps going
+func (s *Scheduler) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.schedules[id]; !ok {
+		return ErrScheduleNotFound
+	}
+	if err := s.store.DeleteSchedule(id); err != nil {
+		return fmt.Errorf("deleting the schedule: %w", err)
+	}
+	delete(s.schedules, id)
+	logger.Info("Schedule removed", logrus.Fields{"scheduleId": id})
+	return nil
+}
+
+// Stop stops submitting jobs, it returns once the scheduler is idle
+func (s *Scheduler) Stop() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+}
+
+// signal wakes the loop up so it waits for the new first run
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop sleeps until the first run of the schedules is due, then runs every due schedule
+func (s *Scheduler) loop() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		wait := idleWait
+		for _, sc := range s.schedules {
+			wait = min(wait, sc.NextRun.Sub(s.now()))
+		}
+		s.mu.Unlock()
+
+		timer := time.NewTimer(max(wait, 0))
+		select {
+		case <-timer.C:
+			s.runDue(s.now().UTC())
+		case <-s.wake:
+			timer.Stop()
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// runDue runs the schedules whose next run is due at now. When the scheduler wakes up past several
+// activations of a schedule, only the latest one runs and the others are recorded as missed.
+func (s *Scheduler) runDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sc := range s.schedules {
+		if sc.NextRun.After(now) {
+			continue
+		}
+		due := sc.NextRun
+		for next := sc.cron.Next(due); !next.After(now); next = sc.cron.Next(next) {
+			sc.miss(due, "the scheduler woke up late")
+			due = next
+		}
+		sc.NextRun = sc.cron.Next(now)
+		s.trigger(sc, due)
+		s.save(sc)
+	}
+}
+
+// save records the state of a schedule. A schedule keeps running when its state cannot be saved, the failure
+// is logged. The scheduler mutex must be held.
+func (s *Scheduler) save(sc *schedule) {
+	if err := s.store.SaveSchedule(sc.snapshot()); err != nil {
+		logger.Error("Failed to save schedule", logrus.Fields{"scheduleId": sc.ID, "error": err})
+	}
+}
+
+// trigger submits the job of the run scheduled at the given time, unless the previous one is still going.
+// The scheduler mutex must be held.
+func (s *Scheduler) trigger(sc *schedule, scheduledAt time.Time) {
+	if sc.LastJobID != "" {
+		// A job the store no longer knows has finished long ago
+		if job, err := s.pool.Get(sc.LastJobID); err == nil && !job.Status.Finished() {
+			sc.miss(scheduledAt, fmt.Sprintf("job %s of the previous run is still %s", job.ID, job.Status))
+			return
+		}
+	}
+	cfg := sc.jobConfig(scheduledAt)
+	job, err := s.pool.Submit(&cfg)
+	if err != nil {
+		sc.miss(scheduledAt, err.Error())
+		return
+	}
+	sc.LastRun, sc.LastJobID = &scheduledAt, job.ID
+	logger.Info("Scheduled job submitted", logrus.Fields{"scheduleId": sc.ID, "jobId": job.ID, "scheduledAt": scheduledAt})
+}
+
+// miss records a run that submitted no job
+func (sc *schedule) miss(scheduledAt time.Time, reason string) {
+	sc.MissedCount++
+	sc.MissedRuns = append(sc.MissedRuns, MissedRun{ScheduledAt: scheduledAt, Reason: reason})
+	if len(sc.MissedRuns) > MaxMissedRuns {
+		sc.MissedRuns = slices.Delete(sc.MissedRuns, 0, len(sc.MissedRuns)-MaxMissedRuns)
+	}
+	logger.Warning("Scheduled run missed", logrus.Fields{"scheduleId": sc.ID, "scheduledAt": scheduledAt, "reason": reason})
+}
+
+// jobConfig returns the configuration of the job scheduled at the given time
+func (sc *schedule) jobConfig(scheduledAt time.Time) config.AppConfig {
+	cfg := sc.Config
+	cfg.Columns = slices.Clone(cfg.Columns)
+	at := scheduledAt.Add(sc.offset)
+	cfg.MapFileNames(func(name string) string {
+		return service.ExpandTimePlaceholders(name, at)
+	})
+	return cfg
+}
+
+func (sc *schedule) snapshot() Schedule {
+	snapshot := sc.Schedule
+	snapshot.MissedRuns = slices.Clone(sc.MissedRuns)
+	return snapshot
+}
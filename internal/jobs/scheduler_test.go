@@ -0,0 +1,283 @@
+package jobs
+
+import (
+	"assignment/config"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSubmitter records the submitted configurations, its jobs run until they are finished by the test
+type fakeSubmitter struct {
+	mu        sync.Mutex
+	jobs      map[string]Job
+	submitted []config.AppConfig
+	err       error // Returned by Submit when set
+}
+
+func newFakeSubmitter() *fakeSubmitter {
+	return &fakeSubmitter{jobs: make(map[string]Job)}
+}
+
+func (f *fakeSubmitter) Submit(cfg *config.AppConfig) (Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return Job{}, f.err
+	}
+	job := Job{ID: newJobID(), Status: StatusRunning, Config: *cfg}
+	f.jobs[job.ID] = job
+	f.submitted = append(f.submitted, *cfg)
+	return job, nil
+}
+
+func (f *fakeSubmitter) Validate(cfg *config.AppConfig) error {
+	dataRoot, _ := filepath.Abs(".")
+	_, err := newManager(cfg, dataRoot)
+	return err
+}
+
+func (f *fakeSubmitter) Get(id string) (Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	job, ok := f.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (f *fakeSubmitter) finish(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	job := f.jobs[id]
+	job.Status = StatusSucceeded
+	f.jobs[id] = job
+}
+
+func (f *fakeSubmitter) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.submitted)
+}
+
+// at returns a time of the test day
+func at(hour, minute int) time.Time {
+	return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+// hourlySpec reads the shard of the previous hour
+func hourlySpec() Schedule {
+	spec := Schedule{
+		Name:   "spins",
+		Cron:   "0 * * * *",
+		Offset: "-1h",
+		Config: *testConfig("shards/{date}/{hour}/*.json", "out/{date}/spins-{hour}-{index}.csv"),
+	}
+	spec.Config.DeadLetterFileName = "out/{date}/rejected-{hour}.ndjson"
+	spec.Config.ManifestFileName = "out/{date}/{hour}.manifest.json"
+	spec.Config.CheckpointFileName = "state/{date}-{hour}.json"
+	return spec
+}
+
+// hourlySchedule adds the schedule of hourlySpec, created at 00:10 of the test day
+func hourlySchedule(t *testing.T) (*Scheduler, *fakeSubmitter, Schedule) {
+	t.Helper()
+	pool := newFakeSubmitter()
+	scheduler, _ := newScheduler(pool, NewMemoryStore(), func() time.Time { return at(0, 10) })
+	t.Cleanup(scheduler.Stop)
+	schedule, err := scheduler.Add(hourlySpec())
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	return scheduler, pool, schedule
+}
+
+func TestSchedulerSubmitsJobs(t *testing.T) {
+	scheduler, pool, schedule := hourlySchedule(t)
+	if !schedule.NextRun.Equal(at(1, 0)) || schedule.ID == "" || schedule.Name != "spins" {
+		t.Fatalf("Unexpected schedule %+v", schedule)
+	}
+
+	scheduler.runDue(at(0, 59))
+	if pool.count() != 0 {
+		t.Fatal("A job was submitted before the schedule was due")
+	}
+	scheduler.runDue(at(1, 0).Add(time.Second))
+	if pool.count() != 1 {
+		t.Fatalf("Expected a job, got %d", pool.count())
+	}
+	cfg := pool.submitted[0]
+	if cfg.InputFileName[0] != "shards/2025-05-24/00/*.json" || cfg.OutputFileName != "out/2025-05-24/spins-00-{index}.csv" {
+		t.Errorf("Unexpected file names %v %s", cfg.InputFileName, cfg.OutputFileName)
+	}
+	if cfg.DeadLetterFileName != "out/2025-05-24/rejected-00.ndjson" || cfg.ManifestFileName != "out/2025-05-24/00.manifest.json" ||
+		cfg.CheckpointFileName != "state/2025-05-24-00.json" {
+		t.Errorf("Unexpected file names %s %s %s", cfg.DeadLetterFileName, cfg.ManifestFileName, cfg.CheckpointFileName)
+	}
+	schedule, _ = scheduler.Get(schedule.ID)
+	if !schedule.NextRun.Equal(at(2, 0)) || !schedule.LastRun.Equal(at(1, 0)) || schedule.LastJobID == "" {
+		t.Errorf("Unexpected schedule %+v", schedule)
+	}
+	if template := schedule.Config.InputFileName[0]; template != "shards/{date}/{hour}/*.json" {
+		t.Errorf("The run changed the template: %s", template)
+	}
+}
+
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	scheduler, pool, schedule := hourlySchedule(t)
+	scheduler.runDue(at(1, 0))
+	first, _ := scheduler.Get(schedule.ID)
+
+	// The job of 01:00 still runs at 02:00
+	scheduler.runDue(at(2, 0))
+	schedule, _ = scheduler.Get(schedule.ID)
+	if pool.count() != 1 || schedule.MissedCount != 1 || schedule.LastJobID != first.LastJobID {
+		t.Fatalf("Expected the run to be skipped, got %d jobs and %+v", pool.count(), schedule)
+	}
+	if missed := schedule.MissedRuns[0]; !missed.ScheduledAt.Equal(at(2, 0)) || !strings.Contains(missed.Reason, "still running") {
+		t.Errorf("Unexpected missed run %+v", missed)
+	}
+
+	pool.finish(first.LastJobID)
+	scheduler.runDue(at(3, 0))
+	if schedule, _ = scheduler.Get(schedule.ID); pool.count() != 2 || schedule.MissedCount != 1 {
+		t.Errorf("Expected a job once the previous one finished, got %d jobs and %+v", pool.count(), schedule)
+	}
+}
+
+func TestSchedulerRecordsMissedRuns(t *testing.T) {
+	scheduler, pool, schedule := hourlySchedule(t)
+
+	// Waking up at 03:30 misses the runs of 01:00 and 02:00, the one of 03:00 is submitted
+	scheduler.runDue(at(3, 30))
+	schedule, _ = scheduler.Get(schedule.ID)
+	if pool.count() != 1 || pool.submitted[0].InputFileName[0] != "shards/2025-05-24/02/*.json" {
+		t.Fatalf("Expected the latest run to be submitted, got %+v", pool.submitted)
+	}
+	if schedule.MissedCount != 2 || !schedule.MissedRuns[0].ScheduledAt.Equal(at(1, 0)) || !schedule.MissedRuns[1].ScheduledAt.Equal(at(2, 0)) {
+		t.Errorf("Unexpected missed runs %+v", schedule.MissedRuns)
+	}
+	if !schedule.NextRun.Equal(at(4, 0)) {
+		t.Errorf("Expected the next run at 04:00, got %s", schedule.NextRun)
+	}
+
+	// A run the pool rejects is missed too
+	pool.finish(schedule.LastJobID)
+	pool.err = ErrQueueFull
+	scheduler.runDue(at(4, 0))
+	schedule, _ = scheduler.Get(schedule.ID)
+	if missed := schedule.MissedRuns[len(schedule.MissedRuns)-1]; schedule.MissedCount != 3 || missed.Reason != ErrQueueFull.Error() {
+		t.Errorf("Expected the rejected run to be missed, got %+v", schedule)
+	}
+
+	// Only the last MaxMissedRuns are kept
+	scheduler.runDue(at(4+MaxMissedRuns+10, 0))
+	schedule, _ = scheduler.Get(schedule.ID)
+	if len(schedule.MissedRuns) != MaxMissedRuns || schedule.MissedCount != 3+MaxMissedRuns+10 {
+		t.Errorf("Expected %d missed runs out of %d, got %d out of %d", MaxMissedRuns, 3+MaxMissedRuns+10, len(schedule.MissedRuns), schedule.MissedCount)
+	}
+}
+
+func TestSchedulerRejectsInvalidSchedules(t *testing.T) {
+	scheduler, _ := newScheduler(newFakeSubmitter(), NewMemoryStore(), time.Now)
+	defer scheduler.Stop()
+
+	for _, spec := range []Schedule{
+		{Cron: "0 * *", Config: *testConfig("input.json", "output.csv")},
+		{Cron: "@hourly", Offset: "an hour", Config: *testConfig("input.json", "output.csv")},
+	} {
+		if _, err := scheduler.Add(spec); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("%+v: expected ErrInvalidSchedule, got %v", spec, err)
+		}
+	}
+	var validationErr *config.ValidationError
+	if _, err := scheduler.Add(Schedule{Cron: "@hourly"}); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+	if _, err := scheduler.Add(Schedule{Cron: "@hourly", Config: *testConfig("in.json", "out-{day}.csv")}); !isInvalidConfig(err) {
+		t.Errorf("Expected the unknown placeholder to be rejected, got %v", err)
+	}
+	if len(scheduler.List()) != 0 {
+		t.Error("Expected rejected schedules not to be listed")
+	}
+}
+
+func TestSchedulerRemove(t *testing.T) {
+	scheduler, pool, schedule := hourlySchedule(t)
+	if err := scheduler.Remove(schedule.ID); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	scheduler.runDue(at(1, 0))
+	if pool.count() != 0 {
+		t.Error("A removed schedule submitted a job")
+	}
+	if _, err := scheduler.Get(schedule.ID); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected ErrScheduleNotFound, got %v", err)
+	}
+	if err := scheduler.Remove(schedule.ID); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected ErrScheduleNotFound, got %v", err)
+	}
+}
+
+func TestSchedulerSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("OpenBoltStore failed: %v", err)
+	}
+	pool := newFakeSubmitter()
+	scheduler, err := newScheduler(pool, store, func() time.Time { return at(0, 10) })
+	if err != nil {
+		t.Fatalf("newScheduler failed: %v", err)
+	}
+	kept, _ := scheduler.Add(hourlySpec())
+	removed, _ := scheduler.Add(hourlySpec())
+	scheduler.runDue(at(1, 0))
+	scheduler.Remove(removed.ID)
+	kept, _ = scheduler.Get(kept.ID)
+	scheduler.Stop()
+	store.Close()
+
+	if store, err = OpenBoltStore(path); err != nil {
+		t.Fatalf("Reopening the store failed: %v", err)
+	}
+	defer store.Close()
+	scheduler, err = newScheduler(pool, store, func() time.Time { return at(3, 30) })
+	if err != nil {
+		t.Fatalf("newScheduler failed: %v", err)
+	}
+	defer scheduler.Stop()
+	schedules := scheduler.List()
+	if len(schedules) != 1 || schedules[0].ID != kept.ID || !schedules[0].NextRun.Equal(at(2, 0)) || schedules[0].LastJobID != kept.LastJobID ||
+		schedules[0].Config.OutputFileName != kept.Config.OutputFileName {
+		t.Fatalf("Expected the schedule to be restored, got %+v", schedules)
+	}
+
+	// The runs due while the service was down are handled like a late wake up
+	pool.finish(kept.LastJobID)
+	scheduler.runDue(at(3, 30))
+	restored, _ := scheduler.Get(kept.ID)
+	if restored.MissedCount != 1 || !restored.LastRun.Equal(at(3, 0)) || !restored.NextRun.Equal(at(4, 0)) {
+		t.Errorf("Unexpected schedule after the restart %+v", restored)
+	}
+}
+
+func TestSchedulerLoop(t *testing.T) {
+	pool := newFakeSubmitter()
+	scheduler, _ := newScheduler(pool, NewMemoryStore(), time.Now)
+	defer scheduler.Stop()
+	if _, err := scheduler.Add(Schedule{Cron: "@every 1s", Config: *testConfig("input.json", "output.csv")}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("The schedule submitted no job")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,199 @@
+package jobs
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrInvalidQuery is returned for job queries with an unknown status, an invalid cursor or a negative limit
+var ErrInvalidQuery = errors.New("invalid job query")
+
+const (
+	// DefaultPageSize is the number of jobs a query returns when it sets no limit
+	DefaultPageSize = 100
+	// MaxPageSize bounds the number of jobs a query returns
+	MaxPageSize = 1000
+)
+
+// Store records the jobs of the pool and the schedules of the scheduler, so they outlive the process when the
+// store is persistent. Jobs are listed in submission order.
+type Store interface {
+	// Save inserts or replaces a job
+	Save(job Job) error
+	// Get returns the job with the given ID, or ErrJobNotFound
+	Get(id string) (Job, error)
+	// List returns a page of the jobs matching the query, and the cursor of the next page, empty after the last one
+	List(query Query) ([]Job, string, error)
+	// SaveSchedule inserts or replaces a schedule
+	SaveSchedule(schedule Schedule) error
+	// DeleteSchedule removes a schedule, removing an unknown one is not an error
+	DeleteSchedule(id string) error
+	// Schedules returns every schedule, in no particular order
+	Schedules() ([]Schedule, error)
+	Close() error
+}
+
+// Query selects jobs by status and submission time, a page at a time
+type Query struct {
+	Status Status    // Only jobs with this status, any status when empty
+	From   time.Time // Only jobs submitted at or after From, when set
+	To     time.Time // Only jobs submitted before To, when set
+	Limit  int       // Page size, 0 selects DefaultPageSize and larger values are lowered to MaxPageSize
+	Cursor string    // Cursor returned with the previous page, empty for the first page
+}
+
+// validate checks the query and applies the default page size
+func (q *Query) validate() error {
+	switch q.Status {
+	case "", StatusQueued, StatusRunning, StatusSucceeded, StatusFailed, StatusCancelled:
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidQuery, q.Status)
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("%w: limit cannot be negative", ErrInvalidQuery)
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultPageSize
+	}
+	q.Limit = min(q.Limit, MaxPageSize)
+	if _, err := q.cursorKey(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// matches reports whether a job passes the status and date filters
+func (q *Query) matches(job Job) bool {
+	return (q.Status == "" || job.Status == q.Status) &&
+		(q.From.IsZero() || !job.CreatedAt.Before(q.From)) &&
+		(q.To.IsZero() || job.CreatedAt.Before(q.To))
+}
+
+// cursorKey decodes the cursor into the key of the last job of the previous page
+func (q *Query) cursorKey() ([]byte, error) {
+	key, err := hex.DecodeString(q.Cursor)
+	if err != nil || (len(key) != 0 && len(key) <= 8) {
+		return nil, fmt.Errorf("%w: invalid cursor %q", ErrInvalidQuery, q.Cursor)
+	}
+	return key, nil
+}
+
+// jobKey orders jobs by submission time, then by ID
+func jobKey(job Job) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(job.CreatedAt.UnixNano()))
+	return append(key, job.ID...)
+}
+
+func cursor(key []byte) string {
+	return hex.EncodeToString(key)
+}
+
+// MemoryStore keeps the jobs in memory, it is the store of pools without a persistent one.
+// Only the last MaxFinishedJobs finished jobs are kept.
+type MemoryStore struct {
+	mu        sync.Mutex
+	jobs      map[string]Job      // Jobs by ID
+	keys      []string            // Keys of the jobs in order, as strings, see jobKey
+	schedules map[string]Schedule // Schedules by ID
+}
+
+// MaxFinishedJobs is the number of finished jobs a MemoryStore keeps, older ones are forgotten
+const MaxFinishedJobs = 1000
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job), schedules: make(map[string]Schedule)}
+}
+
+func (s *MemoryStore) Save(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.ID]; !ok {
+		key := string(jobKey(job))
+		i := sort.SearchStrings(s.keys, key)
+		s.keys = append(s.keys[:i], append([]string{key}, s.keys[i:]...)...)
+	}
+	s.jobs[job.ID] = job
+
+	finished := 0
+	for _, job := range s.jobs {
+		if job.Status.Finished() {
+			finished++
+		}
+	}
+	for i := 0; finished > MaxFinishedJobs && i < len(s.keys); {
+		if id := s.keys[i][8:]; s.jobs[id].Status.Finished() {
+			delete(s.jobs, id)
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			finished--
+			continue
+		}
+		i++
+	}
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (s *MemoryStore) List(query Query) ([]Job, string, error) {
+	if err := query.validate(); err != nil {
+		return nil, "", err
+	}
+	after, _ := query.cursorKey()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := []Job{}
+	for i := sort.SearchStrings(s.keys, string(after)); i < len(s.keys); i++ {
+		key := s.keys[i]
+		if key == string(after) {
+			continue
+		}
+		if job := s.jobs[key[8:]]; query.matches(job) {
+			if len(jobs) == query.Limit {
+				return jobs, cursor(jobKey(jobs[len(jobs)-1])), nil
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, "", nil
+}
+
+func (s *MemoryStore) SaveSchedule(schedule Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (s *MemoryStore) DeleteSchedule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.schedules, id)
+	return nil
+}
+
+func (s *MemoryStore) Schedules() ([]Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedules := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,183 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// stores returns a memory store and a bolt store, to run the same tests against both
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	bolt, err := OpenBoltStore(filepath.Join(t.TempDir(), "store", "jobs.db"))
+	if err != nil {
+		t.Fatalf("OpenBoltStore failed: %v", err)
+	}
+	t.Cleanup(func() { bolt.Close() })
+	return map[string]Store{"memory": NewMemoryStore(), "bolt": bolt}
+}
+
+// day is the base submission time of the test jobs
+var day = time.Date(2025, 5, 24, 0, 0, 0, 0, time.UTC)
+
+// saveJobs saves n jobs submitted an hour apart, every third one failed
+func saveJobs(t *testing.T, store Store, n int) []Job {
+	t.Helper()
+	jobs := make([]Job, n)
+	for i := range jobs {
+		jobs[i] = Job{ID: newJobID(), Status: StatusSucceeded, CreatedAt: day.Add(time.Duration(i) * time.Hour)}
+		if i%3 == 0 {
+			jobs[i].Status = StatusFailed
+		}
+		if err := store.Save(jobs[i]); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	return jobs
+}
+
+// listAll follows the cursors and returns the IDs of every page
+func listAll(t *testing.T, store Store, query Query) [][]string {
+	t.Helper()
+	var pages [][]string
+	for {
+		jobs, next, err := store.List(query)
+		if err != nil {
+			t.Fatalf("List(%+v) failed: %v", query, err)
+		}
+		page := []string{}
+		for _, job := range jobs {
+			page = append(page, job.ID)
+		}
+		pages = append(pages, page)
+		if next == "" {
+			return pages
+		}
+		query.Cursor = next
+	}
+}
+
+func TestStoreList(t *testing.T) {
+	for name, store := range stores(t) {
+		jobs := saveJobs(t, store, 10)
+		// Saving a job again replaces it without moving it
+		jobs[4].Status = StatusCancelled
+		if err := store.Save(jobs[4]); err != nil {
+			t.Fatalf("%s: Save failed: %v", name, err)
+		}
+		ids := func(indexes ...int) []string {
+			page := []string{}
+			for _, i := range indexes {
+				page = append(page, jobs[i].ID)
+			}
+			return page
+		}
+
+		for _, test := range []struct {
+			query Query
+			pages [][]string
+		}{
+			{Query{}, [][]string{ids(0, 1, 2, 3, 4, 5, 6, 7, 8, 9)}},
+			{Query{Limit: 4}, [][]string{ids(0, 1, 2, 3), ids(4, 5, 6, 7), ids(8, 9)}},
+			{Query{Limit: 5}, [][]string{ids(0, 1, 2, 3, 4), ids(5, 6, 7, 8, 9)}},
+			{Query{Status: StatusFailed, Limit: 2}, [][]string{ids(0, 3), ids(6, 9)}},
+			{Query{Status: StatusCancelled}, [][]string{ids(4)}},
+			{Query{From: day.Add(2 * time.Hour), To: day.Add(5 * time.Hour)}, [][]string{ids(2, 3, 4)}},
+			{Query{Status: StatusSucceeded, From: day.Add(7 * time.Hour), Limit: 1}, [][]string{ids(7), ids(8)}},
+			{Query{To: day}, [][]string{{}}},
+		} {
+			if pages := listAll(t, store, test.query); !slices.EqualFunc(pages, test.pages, slices.Equal[[]string]) {
+				t.Errorf("%s: List(%+v) = %v, expected %v", name, test.query, pages, test.pages)
+			}
+		}
+
+		if job, err := store.Get(jobs[4].ID); err != nil || job.Status != StatusCancelled || !job.CreatedAt.Equal(jobs[4].CreatedAt) {
+			t.Errorf("%s: Get returned %+v, %v", name, job, err)
+		}
+		if _, err := store.Get("unknown"); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("%s: expected ErrJobNotFound, got %v", name, err)
+		}
+		for _, query := range []Query{{Status: "done"}, {Limit: -1}, {Cursor: "xyz"}, {Cursor: "0102"}} {
+			if _, _, err := store.List(query); !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("%s: List(%+v): expected ErrInvalidQuery, got %v", name, query, err)
+			}
+		}
+	}
+}
+
+func TestMemoryStoreForgetsOldFinishedJobs(t *testing.T) {
+	store := NewMemoryStore()
+	running := Job{ID: "running", Status: StatusRunning, CreatedAt: day}
+	store.Save(running)
+	jobs := saveJobs(t, store, MaxFinishedJobs+2)
+	for _, id := range []string{jobs[0].ID, jobs[1].ID} {
+		if _, err := store.Get(id); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("Expected job %s to be forgotten, got %v", id, err)
+		}
+	}
+	for _, id := range []string{running.ID, jobs[2].ID} {
+		if _, err := store.Get(id); err != nil {
+			t.Errorf("Expected job %s to be kept, got %v", id, err)
+		}
+	}
+}
+
+func TestStoreSchedules(t *testing.T) {
+	for name, store := range stores(t) {
+		first := Schedule{ID: "a", Cron: "@hourly", Config: *testConfig("input.json", "output.csv")}
+		second := Schedule{ID: "b", Cron: "@daily"}
+		for _, schedule := range []Schedule{first, second} {
+			if err := store.SaveSchedule(schedule); err != nil {
+				t.Fatalf("%s: SaveSchedule failed: %v", name, err)
+			}
+		}
+		first.MissedCount = 2
+		store.SaveSchedule(first)
+		if err := store.DeleteSchedule(second.ID); err != nil {
+			t.Fatalf("%s: DeleteSchedule failed: %v", name, err)
+		}
+		if err := store.DeleteSchedule("unknown"); err != nil {
+			t.Errorf("%s: expected deleting an unknown schedule to succeed, got %v", name, err)
+		}
+		schedules, err := store.Schedules()
+		if err != nil || len(schedules) != 1 || schedules[0].ID != "a" || schedules[0].MissedCount != 2 || schedules[0].Config.OutputFileName != "output.csv" {
+			t.Errorf("%s: unexpected schedules %+v, %v", name, schedules, err)
+		}
+	}
+}
+
+func TestBoltStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("OpenBoltStore failed: %v", err)
+	}
+	pool, _ := NewPool(1, 1, store, ".")
+	cfg := testConfig("input.json", "output.csv")
+	running := newBlockingExtractor()
+	interrupted, _ := pool.enqueue(cfg, running)
+	<-running.started
+	// Closing the store first leaves the job running in it, as a crash would
+	store.Close()
+	pool.Shutdown(context.Background())
+
+	if store, err = OpenBoltStore(path); err != nil {
+		t.Fatalf("Reopening the store failed: %v", err)
+	}
+	defer store.Close()
+	pool, err = NewPool(1, 1, store, ".")
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer pool.Shutdown(context.Background())
+	job, err := pool.Get(interrupted.ID)
+	if err != nil || job.Status != StatusFailed || job.Error == "" || job.FinishedAt == nil || job.Config.OutputFileName != "output.csv" {
+		t.Errorf("Expected the interrupted job to be failed, got %+v, %v", job, err)
+	}
+	if _, err := pool.Cancel(interrupted.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Expected ErrJobFinished, got %v", err)
+	}
+}
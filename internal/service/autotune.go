@@ -0,0 +1,186 @@
+package service
+
+import (
+	"assignment/pkg/logger"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Auto passed as the worker count or a channel size of NewExtractionManager sizes it at the start of every run,
+// from the CPUs available to the process and the size of the input
+const Auto = -1
+
+const (
+	// bytesPerWorker is the input size that keeps one worker busy long enough to be worth starting
+	bytesPerWorker = 4 << 20
+	// linesPerWorker is the channel capacity given to each worker when channel sizes are tuned automatically
+	linesPerWorker = 256
+	// maxAutoChannelSize bounds the tuned channel sizes, and so the memory held by lines in flight
+	maxAutoChannelSize = 16384
+	// DefaultAdaptInterval is how often the channel occupancy is sampled when workers adapt at runtime
+	DefaultAdaptInterval = 250 * time.Millisecond
+)
+
+// validSize reports whether n is Auto or between 1 and limit
+func validSize(n, limit int) bool {
+	return n == Auto || (n > 0 && n <= limit)
+}
+
+// cgroupRoot is where the cgroup file system is mounted, replaced in tests
+var cgroupRoot = "/sys/fs/cgroup"
+
+// availableCPUs returns the number of CPUs the extraction can use: GOMAXPROCS, lowered to the CPU quota
+// of the cgroup when the process runs in a container with a limit
+func availableCPUs() int {
+	cpus := runtime.GOMAXPROCS(0)
+	if quota, ok := cgroupCPUQuota(cgroupRoot); ok {
+		cpus = min(cpus, max(1, int(math.Ceil(quota))))
+	}
+	return cpus
+}
+
+// cgroupCPUQuota reads the CPU limit, in CPUs, from cgroup v2 cpu.max or the cgroup v1 CFS quota.
+// It returns false when no limit is set or the files cannot be read.
+func cgroupCPUQuota(root string) (float64, bool) {
+	if data, err := os.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		// "max 100000" without a limit, "150000 100000" for 1.5 CPUs
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		return parseQuota(fields[0], fields[1])
+	}
+	quota, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, false
+	}
+	period, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, false
+	}
+	return parseQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func parseQuota(quota, period string) (float64, bool) {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return float64(q) / float64(p), true
+}
+
+// inputSize returns the total size in bytes of the input files, or -1 when it is unknown, e.g. for standard input
+func inputSize(files []string) int64 {
+	var total int64
+	for _, file := range files {
+		if file == StdioFileName {
+			return -1
+		}
+		info, err := os.Stat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		total += info.Size()
+	}
+	return total
+}
+
+// autoWorkers sizes the worker pool: one worker per CPU, but no more than the input keeps busy.
+// Compressed input is counted by its size on disk, so it gets fewer workers than its content would.
+func autoWorkers(cpus int, size int64) int {
+	if size < 0 {
+		return cpus
+	}
+	return int(min(int64(cpus), max(1, (size+bytesPerWorker-1)/bytesPerWorker)))
+}
+
+// autoChannelSize gives every worker a backlog of linesPerWorker lines
+func autoChannelSize(workers int) int {
+	return min(workers*linesPerWorker, maxAutoChannelSize)
+}
+
+// tuneRun resolves the Auto settings for a run over the given input files
+func (p *ExtractionManager) tuneRun(files []string) {
+	p.workers, p.runLinesChannelSize, p.runResultsChannelSize = p.numWorkers, p.linesChannelSize, p.resultsChannelSize
+	if p.numWorkers != Auto && p.linesChannelSize != Auto && p.resultsChannelSize != Auto {
+		return
+	}
+	cpus, size := availableCPUs(), inputSize(files)
+	if p.workers == Auto {
+		p.workers = autoWorkers(cpus, size)
+	}
+	if p.runLinesChannelSize == Auto {
+		p.runLinesChannelSize = autoChannelSize(p.workers)
+	}
+	if p.runResultsChannelSize == Auto {
+		p.runResultsChannelSize = autoChannelSize(p.workers)
+	}
+	logger.Info("Extraction sized automatically", logrus.Fields{
+		"cpus":               cpus,
+		"inputBytes":         size,
+		"numWorkers":         p.workers,
+		"linesChannelSize":   p.runLinesChannelSize,
+		"resultsChannelSize": p.runResultsChannelSize,
+	})
+}
+
+// adaptWorkers samples the occupancy of the channels every adaptInterval until reading is done.
+// A lines channel that stays mostly full while the writer keeps up means the workers are the bottleneck,
+// so a worker is added, up to one per CPU or numWorkers when that is higher. A lines channel that stays
+// mostly empty means the reader is the bottleneck, so an idle worker is retired, keeping at least one.
+func (p *ExtractionManager) adaptWorkers(lines chan inputLine, results chan outputRow, readDone <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(p.adaptInterval)
+	defer ticker.Stop()
+
+	workers, maxWorkers := p.workers, max(p.workers, availableCPUs())
+	busy, idle := 0, 0
+	for {
+		select {
+		case <-readDone:
+			return
+		case <-ticker.C:
+		}
+		linesFull := len(lines)*4 >= cap(lines)*3
+		resultsFull := len(results)*4 >= cap(results)*3
+		linesEmpty := len(lines)*8 <= cap(lines)
+		switch {
+		case linesFull && !resultsFull:
+			busy, idle = busy+1, 0
+		case linesEmpty:
+			busy, idle = 0, idle+1
+		default:
+			busy, idle = 0, 0
+		}
+
+		// Act on two consecutive samples, a single one is often a burst
+		if busy >= 2 && workers < maxWorkers {
+			wg.Add(1)
+			go p.worker(lines, results, wg)
+			workers, busy = workers+1, 0
+			logger.Debug("Worker added", logrus.Fields{"numWorkers": workers, "linesQueued": len(lines)})
+		}
+		if idle >= 2 && workers > 1 {
+			select {
+			case p.retire <- struct{}{}:
+				workers--
+				logger.Debug("Worker retired", logrus.Fields{"numWorkers": workers, "linesQueued": len(lines)})
+			default:
+				// No worker is idle right now
+			}
+			idle = 0
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCgroupCPUQuota(t *testing.T) {
+	for name, test := range map[string]struct {
+		files    map[string]string
+		expected float64
+		ok       bool
+	}{
+		"v2 limit":    {files: map[string]string{"cpu.max": "150000 100000\n"}, expected: 1.5, ok: true},
+		"v2 no limit": {files: map[string]string{"cpu.max": "max 100000\n"}},
+		"v1 limit":    {files: map[string]string{"cpu/cpu.cfs_quota_us": "200000\n", "cpu/cpu.cfs_period_us": "100000\n"}, expected: 2, ok: true},
+		"v1 no limit": {files: map[string]string{"cpu/cpu.cfs_quota_us": "-1\n", "cpu/cpu.cfs_period_us": "100000\n"}},
+		"no cgroup":   {},
+	} {
+		root := t.TempDir()
+		for fileName, content := range test.files {
+			os.MkdirAll(filepath.Dir(filepath.Join(root, fileName)), 0755)
+			os.WriteFile(filepath.Join(root, fileName), []byte(content), 0644)
+		}
+		quota, ok := cgroupCPUQuota(root)
+		if quota != test.expected || ok != test.ok {
+			t.Errorf("%s: expected %v, %v, got %v, %v", name, test.expected, test.ok, quota, ok)
+		}
+	}
+}
+
+func TestAutoWorkers(t *testing.T) {
+	for _, test := range []struct {
+		cpus     int
+		size     int64
+		expected int
+	}{
+		{cpus: 8, size: -1, expected: 8},
+		{cpus: 8, size: 0, expected: 1},
+		{cpus: 8, size: bytesPerWorker + 1, expected: 2},
+		{cpus: 8, size: 100 * bytesPerWorker, expected: 8},
+	} {
+		if workers := autoWorkers(test.cpus, test.size); workers != test.expected {
+			t.Errorf("autoWorkers(%d, %d) = %d, expected %d", test.cpus, test.size, workers, test.expected)
+		}
+	}
+	if size := autoChannelSize(1000); size != maxAutoChannelSize {
+		t.Errorf("Expected the channel size to be bounded, got %d", size)
+	}
+}
+
+func TestExtractAutoSizes(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 1000)
+
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), Auto, 1000, Auto, Auto)
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	// A small input keeps a single worker busy
+	if parser.workers != 1 || parser.runLinesChannelSize != linesPerWorker || parser.runResultsChannelSize != linesPerWorker {
+		t.Errorf("Unexpected sizes %d, %d, %d", parser.workers, parser.runLinesChannelSize, parser.runResultsChannelSize)
+	}
+	if result.Stats.LinesWritten != 1000-31 {
+		t.Errorf("Expected %d rows, got %d", 1000-31, result.Stats.LinesWritten)
+	}
+
+	if _, err := NewExtractionManager(inputFileName, "output.csv", -2, 1000, Auto, Auto); err == nil {
+		t.Error("Expected a negative worker count other than Auto to be rejected")
+	}
+}
+
+func TestAdaptWorkersAddsWorkers(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	defer func(root string) { cgroupRoot = root }(cgroupRoot)
+	cgroupRoot = t.TempDir()
+
+	parser, err := NewExtractionManager("input.json", "output.csv", 1, 1, 1, 1, WithAdaptiveWorkers(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	// No worker is running, so the lines channel stays full until the tuner starts one
+	lines := make(chan inputLine, 4)
+	results := make(chan outputRow, 100)
+	for i := int64(1); i <= 4; i++ {
+		lines <- inputLine{number: i, source: &inputSource{}, line: i, data: `{"spins": 1, "server_time": "t"}`}
+	}
+	readDone := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go parser.adaptWorkers(lines, results, readDone, &wg)
+
+	deadline := time.After(5 * time.Second)
+	for i := 0; i < 4; i++ {
+		select {
+		case <-results:
+		case <-deadline:
+			t.Fatal("No worker was added")
+		}
+	}
+	close(readDone)
+	close(lines)
+	wg.Wait()
+}
+
+func TestExtractAdaptiveWorkers(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 20000)
+
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), 1, 5000, Auto, 8,
+		WithAdaptiveWorkers(time.Millisecond), WithPreserveOrder(0))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	if expected := int64(20000 - 607); result.Stats.LinesWritten != expected {
+		t.Errorf("Expected %d rows, got %d", expected, result.Stats.LinesWritten)
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	ErrCheckpoint        = errors.New("error writing checkpoint")
+	ErrInvalidCheckpoint = errors.New("checkpoint does not match the extraction")
+)
+
+// DefaultCheckpointEvery is the number of committed lines between checkpoints when none is configured
+const DefaultCheckpointEvery = 10000
+
+// Checkpoint is the persisted progress of an extraction run.
+// Every line of the input files before InputFiles[InputSource] and every line of that file before InputOffset
+// has been written to the output, or rejected, and the output files up to and including OutputFiles[FileIndex]
+// hold exactly the rows of those lines.
+type Checkpoint struct {
+	RunID          string         `json:"runId"`
+	StartTime      time.Time      `json:"startTime"`
+	InputFile      string         `json:"inputFile"`
+	InputFiles     []string       `json:"inputFiles"`     // Input files of the run, in reading order
+	InputSource    int            `json:"inputSource"`    // Index of the input file being read
+	SourceLine     int64          `json:"sourceLine"`     // Number of lines committed from that input file
+	InputOffset    int64          `json:"inputOffset"`    // Byte offset of the first line that is not committed
+	LinesCommitted int64          `json:"linesCommitted"` // Number of input lines written or rejected
+	OutputFiles    []string       `json:"outputFiles"`
+	FileStats      []ManifestFile `json:"fileStats,omitempty"` // Rows and server_time range of each output file, for the manifest
+	FileIndex      int            `json:"fileIndex"`           // Index of the output file currently being written, -1 before the first one
+	FileRows       int            `json:"fileRows"`            // Rows in the current output file
+	FileSize       int64          `json:"fileSize"`            // Bytes in the current output file
+	DeadLetterSize int64          `json:"deadLetterSize"`      // Bytes in the dead-letter file
+	UpdatedAt      time.Time      `json:"updatedAt"`
+}
+
+// loadCheckpoint reads a checkpoint file, it returns nil without an error when the file does not exist
+func loadCheckpoint(fileName string) (*Checkpoint, error) {
+	data, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidCheckpoint, fileName, err)
+	}
+	return &checkpoint, nil
+}
+
+// save atomically replaces the checkpoint file, so a crash never leaves a partially written checkpoint
+func (c *Checkpoint) save(fileName string) error {
+	c.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, data)
+}
+
+// writeFileAtomic replaces a file through a temporary file in the same directory, so readers see either
+// the previous content or the whole new one
+func writeFileAtomic(fileName string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
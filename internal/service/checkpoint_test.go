@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCheckpointInput(t *testing.T, fileName string, numLines int) {
+	t.Helper()
+	var content bytes.Buffer
+	for i := 0; i < numLines; i++ {
+		if i%33 == 0 {
+			content.WriteString("not json\n")
+			continue
+		}
+		fmt.Fprintf(&content, `{"spins": %d, "server_time": "2025-05-24 00:00:%02d UTC"}`+"\n", i, i%60)
+	}
+	if err := os.WriteFile(fileName, content.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+}
+
+func readFiles(t *testing.T, fileNames []string) [][]byte {
+	t.Helper()
+	contents := make([][]byte, len(fileNames))
+	for i, fileName := range fileNames {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", fileName, err)
+		}
+		contents[i] = data
+	}
+	return contents
+}
+
+func TestExtractResumeFromCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 1000)
+	checkpointFileName := filepath.Join(dir, "checkpoint.json")
+	outputFileName := filepath.Join(dir, "out", "output.csv")
+
+	newManager := func() *ExtractionManager {
+		parser, err := NewExtractionManager(inputFileName, outputFileName, 4, 100, 10, 10,
+			WithCheckpoint(checkpointFileName, 50), WithResume())
+		if err != nil {
+			t.Fatalf("Failed to create extraction manager: %v", err)
+		}
+		return parser
+	}
+
+	// Reference run, the checkpoint is removed once the run completes
+	reference, err := newManager().Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	expected := readFiles(t, reference.OutputFiles)
+	if _, err := os.Stat(checkpointFileName); !os.IsNotExist(err) {
+		t.Fatalf("Checkpoint should be removed after a completed run, stat returned %v", err)
+	}
+
+	// Simulate a crash after line 400: the checkpoint was taken at line 400, rows after it reached
+	// the current file and the next file was already created
+	input, _ := os.ReadFile(inputFileName)
+	offset := int64(bytes.Index(input, []byte(`{"spins": 400,`)))
+	rowsBefore := 400 - 400/33 - 1 // lines 0..399 minus the malformed ones
+	fileIndex, fileRows := rowsBefore/100, rowsBefore%100
+	fileSize := int64(len(bytes.Join(bytes.SplitAfter(expected[fileIndex], []byte("\n"))[:fileRows], nil)))
+
+	os.WriteFile(reference.OutputFiles[fileIndex], append(expected[fileIndex][:fileSize:fileSize], "partial row after the checkpoint\n"...), 0644)
+	os.WriteFile(reference.OutputFiles[fileIndex+1], []byte("stale\n"), 0644)
+	for _, outputFile := range reference.OutputFiles[fileIndex+2:] {
+		os.Remove(outputFile)
+	}
+	checkpoint := &Checkpoint{
+		RunID:          reference.RunID,
+		InputFile:      inputFileName,
+		InputOffset:    offset,
+		LinesCommitted: 400,
+		OutputFiles:    reference.OutputFiles[:fileIndex+1],
+		FileIndex:      fileIndex,
+		FileRows:       fileRows,
+		FileSize:       fileSize,
+	}
+	if err := checkpoint.save(checkpointFileName); err != nil {
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+
+	resumed, err := newManager().Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Resumed extraction failed: %v", err)
+	}
+	if resumed.RunID != reference.RunID || resumed.Stats.LinesRead != 600 {
+		t.Errorf("Expected run %s to resume at line 400, got %+v", reference.RunID, resumed)
+	}
+	actual := readFiles(t, resumed.OutputFiles)
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected %d output files, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if !bytes.Equal(actual[i], expected[i]) {
+			t.Errorf("Output file %d differs after resume", i)
+		}
+	}
+}
+
+func TestExtractInterruptedKeepsCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 100)
+	checkpointFileName := filepath.Join(dir, "checkpoint.json")
+
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), 2, 10, 1, 1, WithCheckpoint(checkpointFileName, 0))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := parser.Extract(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	checkpoint, err := loadCheckpoint(checkpointFileName)
+	if err != nil || checkpoint == nil {
+		t.Fatalf("Expected a checkpoint after an interrupted run, got %v, %v", checkpoint, err)
+	}
+	if checkpoint.InputFile != inputFileName || checkpoint.RunID != parser.RunID() {
+		t.Errorf("Unexpected checkpoint %+v", checkpoint)
+	}
+}
+
+func TestExtractFailsWhenCheckpointCannotBeSaved(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 100)
+	// A checkpoint under a regular file cannot be written
+	os.WriteFile(filepath.Join(dir, "file"), nil, 0644)
+	checkpointFileName := filepath.Join(dir, "file", "checkpoint.json")
+
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, format, "output"), 2, 10, 1, 1,
+			WithOutputFormat(format), WithCheckpoint(checkpointFileName, 10))
+		if err != nil {
+			t.Fatalf("Failed to create extraction manager: %v", err)
+		}
+		if _, err := parser.Extract(context.Background()); !errors.Is(err, ErrCheckpoint) {
+			t.Errorf("%s: expected ErrCheckpoint, got %v", format, err)
+		}
+	}
+}
+
+func TestCheckpointConfiguration(t *testing.T) {
+	if _, err := NewExtractionManager("input.json", "output.csv", 1, 1, 1, 1, WithResume()); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected resume without a checkpoint file to be rejected, got %v", err)
+	}
+	if _, err := NewExtractionManager("input.json", "output", 1, 1, 1, 1, WithOutputFormat(FormatParquet), WithCheckpoint("checkpoint.json", 0)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected checkpoints with parquet output to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ColumnType is the type a source JSON value is converted to before it is written out.
+type ColumnType string
+
+const (
+	ColumnString ColumnType = "string"
+	ColumnInt    ColumnType = "int"
+	ColumnFloat  ColumnType = "float"
+	ColumnBool   ColumnType = "bool"
+)
+
+// Column maps a value of the input JSON record to an output column.
+// Source is a dot separated path into the record, e.g. "meta.server_time".
+type Column struct {
+	Source   string
+	Name     string
+	Type     ColumnType
+	Required bool
+}
+
+// DefaultColumns reproduces the historical spins,server_time output.
+var DefaultColumns = []Column{
+	{Source: "spins", Name: "spins", Type: ColumnInt},
+	{Source: "server_time", Name: "server_time", Type: ColumnString},
+}
+
+var (
+	ErrMissingField = errors.New("required field is missing")
+	ErrTrailingData = errors.New("unexpected data after the JSON record")
+)
+
+// validateColumns checks that every column has a source, a unique name and a known type
+func validateColumns(columns []Column) error {
+	if len(columns) == 0 {
+		return errors.New("at least one column must be configured")
+	}
+	names := make(map[string]bool, len(columns))
+	for i, column := range columns {
+		if column.Source == "" {
+			return fmt.Errorf("column %d: source cannot be empty", i)
+		}
+		if column.Name == "" {
+			return fmt.Errorf("column %d: name cannot be empty", i)
+		}
+		if names[column.Name] {
+			return fmt.Errorf("column %d: duplicate name %q", i, column.Name)
+		}
+		names[column.Name] = true
+		switch column.Type {
+		case ColumnString, ColumnInt, ColumnFloat, ColumnBool:
+		default:
+			return fmt.Errorf("column %q: unknown type %q", column.Name, column.Type)
+		}
+	}
+	return nil
+}
+
+// extractRow decodes a single JSON line and returns the configured columns in order.
+func extractRow(line []byte, columns []Column) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+
+	var document map[string]interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	// Decode stops after the first value, anything after it makes the line malformed
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, ErrTrailingData
+	}
+
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		value, err := column.extract(document)
+		if err != nil {
+			return nil, err
+		}
+		row[i] = value
+	}
+	return row, nil
+}
+
+// extract looks up the column source path in the document and formats it according to the column type.
+// Missing or null values produce the zero value of the type unless the column is required.
+func (c Column) extract(document map[string]interface{}) (string, error) {
+	var value interface{} = document
+	for _, key := range strings.Split(c.Source, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			value = nil
+			break
+		}
+		value = object[key]
+	}
+
+	if value == nil {
+		if c.Required {
+			return "", fmt.Errorf("%w: %s", ErrMissingField, c.Source)
+		}
+		return c.zeroValue(), nil
+	}
+
+	switch c.Type {
+	case ColumnString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case ColumnInt:
+		if n, ok := value.(json.Number); ok {
+			i, err := n.Int64()
+			if err != nil {
+				return "", fmt.Errorf("field %s: %q is not an integer", c.Source, n)
+			}
+			return strconv.FormatInt(i, 10), nil
+		}
+	case ColumnFloat:
+		if n, ok := value.(json.Number); ok {
+			f, err := n.Float64()
+			if err != nil {
+				return "", fmt.Errorf("field %s: %q is not a number", c.Source, n)
+			}
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+	case ColumnBool:
+		if b, ok := value.(bool); ok {
+			return strconv.FormatBool(b), nil
+		}
+	}
+	return "", fmt.Errorf("field %s: cannot use %v as %s", c.Source, value, c.Type)
+}
+
+func (c Column) zeroValue() string {
+	switch c.Type {
+	case ColumnInt, ColumnFloat:
+		return "0"
+	case ColumnBool:
+		return "false"
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExtractRowDefaultColumns(t *testing.T) {
+	line := `{"spins":27,"time":"2026-12-28 16:53:11.72949 UTC","server_time":"2023-08-23 02:10:57.89889 UTC"}`
+	row, err := extractRow([]byte(line), DefaultColumns)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"27", "2023-08-23 02:10:57.89889 UTC"}
+	if !reflect.DeepEqual(row, expected) {
+		t.Errorf("Expected %v, got %v", expected, row)
+	}
+}
+
+func TestExtractRowConfiguredColumns(t *testing.T) {
+	columns := []Column{
+		{Source: "insertion_date", Name: "inserted", Type: ColumnString},
+		{Source: "meta.ratio", Name: "ratio", Type: ColumnFloat},
+		{Source: "meta.active", Name: "active", Type: ColumnBool},
+		{Source: "spins", Name: "spins", Type: ColumnInt},
+	}
+	line := `{"spins":3,"insertion_date":"2020-05-10","meta":{"ratio":0.25,"active":true}}`
+	row, err := extractRow([]byte(line), columns)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"2020-05-10", "0.25", "true", "3"}
+	if !reflect.DeepEqual(row, expected) {
+		t.Errorf("Expected %v, got %v", expected, row)
+	}
+}
+
+func TestExtractRowMissingAndInvalidValues(t *testing.T) {
+	row, err := extractRow([]byte(`{"server_time":null}`), DefaultColumns)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(row, []string{"0", ""}) {
+		t.Errorf("Expected zero values for missing fields, got %v", row)
+	}
+
+	required := []Column{{Source: "spins", Name: "spins", Type: ColumnInt, Required: true}}
+	if _, err := extractRow([]byte(`{}`), required); !errors.Is(err, ErrMissingField) {
+		t.Errorf("Expected ErrMissingField, got %v", err)
+	}
+	if _, err := extractRow([]byte(`{"spins":"ten"}`), DefaultColumns); err == nil {
+		t.Error("Expected an error for a string in an int column")
+	}
+	if _, err := extractRow([]byte(`{"spins":1.5}`), DefaultColumns); err == nil {
+		t.Error("Expected an error for a fraction in an int column")
+	}
+	if _, err := extractRow([]byte(`{"spins":`), DefaultColumns); err == nil {
+		t.Error("Expected an error for malformed JSON")
+	}
+	for _, line := range []string{`{"spins":1} garbage`, `{"spins":1}{"spins":2}`, `{"spins":1} 2`} {
+		if _, err := extractRow([]byte(line), DefaultColumns); !errors.Is(err, ErrTrailingData) {
+			t.Errorf("%s: expected ErrTrailingData, got %v", line, err)
+		}
+	}
+	if _, err := extractRow([]byte(`{"spins":1}  `+"\r"), DefaultColumns); err != nil {
+		t.Errorf("Expected trailing whitespace to be accepted, got %v", err)
+	}
+}
+
+func TestValidateColumns(t *testing.T) {
+	if err := validateColumns(DefaultColumns); err != nil {
+		t.Errorf("Default columns should be valid: %v", err)
+	}
+	invalid := [][]Column{
+		nil,
+		{{Source: "", Name: "a", Type: ColumnString}},
+		{{Source: "a", Name: "a", Type: "date"}},
+		{{Source: "a", Name: "a", Type: ColumnString}, {Source: "b", Name: "a", Type: ColumnInt}},
+	}
+	for _, columns := range invalid {
+		if err := validateColumns(columns); err == nil {
+			t.Errorf("Expected %v to be rejected", columns)
+		}
+	}
+}
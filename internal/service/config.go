@@ -0,0 +1,73 @@
+package service
+
+import "assignment/config"
+
+// ConfigOptions translates the optional parts of an AppConfig into extraction options.
+// The sizes passed to NewExtractionManager need no translation, config.Auto has the value of Auto.
+func ConfigOptions(cfg *config.AppConfig) []Option {
+	var opts []Option
+	if len(cfg.InputFileName) > 1 {
+		opts = append(opts, WithInputFiles(cfg.InputFileName...))
+	}
+	if cfg.InputParallelism != 0 {
+		opts = append(opts, WithInputParallelism(cfg.InputParallelism))
+	}
+	if len(cfg.Columns) > 0 {
+		columns := make([]Column, len(cfg.Columns))
+		for i, c := range cfg.Columns {
+			name := c.Name
+			if name == "" {
+				name = c.Source
+			}
+			columnType := ColumnType(c.Type)
+			if columnType == "" {
+				columnType = ColumnString
+			}
+			columns[i] = Column{Source: c.Source, Name: name, Type: columnType, Required: c.Required}
+		}
+		opts = append(opts, WithColumns(columns...))
+	}
+	if cfg.OutputFormat != "" {
+		opts = append(opts, WithOutputFormat(cfg.OutputFormat))
+	}
+	if cfg.RunID != "" {
+		opts = append(opts, WithRunID(cfg.RunID))
+	}
+	if cfg.PartitionKey != "" {
+		opts = append(opts, WithPartitionKey(cfg.PartitionKey))
+	}
+	if cfg.DeadLetterFileName != "" {
+		opts = append(opts, WithDeadLetterFile(cfg.DeadLetterFileName))
+	}
+	if cfg.ManifestFileName != "" {
+		opts = append(opts, WithManifest(cfg.ManifestFileName))
+	}
+	if cfg.MaxMalformedLines != 0 || cfg.MaxMalformedPercent != 0 {
+		opts = append(opts, WithMalformedThreshold(cfg.MaxMalformedLines, cfg.MaxMalformedPercent))
+	}
+	if cfg.PreserveOrder {
+		opts = append(opts, WithPreserveOrder(cfg.ReorderBufferSize))
+	}
+	if cfg.CheckpointFileName != "" {
+		opts = append(opts, WithCheckpoint(cfg.CheckpointFileName, cfg.CheckpointEvery))
+	}
+	if cfg.Resume {
+		opts = append(opts, WithResume())
+	}
+	if cfg.MaxLineSize != 0 {
+		opts = append(opts, WithMaxLineSize(cfg.MaxLineSize))
+	}
+	if cfg.InputCompression != "" {
+		opts = append(opts, WithInputCompression(cfg.InputCompression))
+	}
+	if cfg.OutputCompression != "" {
+		opts = append(opts, WithOutputCompression(cfg.OutputCompression, cfg.OutputCompressionLevel))
+	}
+	if cfg.MaxBytesPerFile != 0 {
+		opts = append(opts, WithMaxBytesPerFile(cfg.MaxBytesPerFile))
+	}
+	if cfg.AdaptiveWorkers {
+		opts = append(opts, WithAdaptiveWorkers(0))
+	}
+	return opts
+}
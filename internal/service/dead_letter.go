@@ -0,0 +1,113 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DeadLetterRecord is a rejected input line together with the reason it was rejected
+type DeadLetterRecord struct {
+	File   string `json:"file"`   // Input file the line was read from
+	Line   int64  `json:"line"`   // 1-based line number in the input file
+	Offset int64  `json:"offset"` // Byte offset of the start of the line in the input file
+	Error  string `json:"error"`
+	Data   string `json:"data"`
+}
+
+// deadLetterSink appends rejected lines as NDJSON to a file.
+// The file is only created once the first line is rejected, and it is safe for concurrent use by the workers.
+type deadLetterSink struct {
+	mu       sync.Mutex
+	fileName string
+	file     *os.File
+	writer   *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func newDeadLetterSink(fileName string) *deadLetterSink {
+	return &deadLetterSink{fileName: fileName}
+}
+
+// resume continues the dead-letter file of a checkpoint, keeping its first size bytes, the records of the
+// lines committed before the checkpoint. The records written after the checkpoint are dropped.
+func (d *deadLetterSink) resume(size int64) error {
+	if size == 0 {
+		if err := os.Remove(d.fileName); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	file, err := os.OpenFile(d.fileName, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	d.setFile(file)
+	return nil
+}
+
+// Write appends a record to the dead-letter file
+func (d *deadLetterSink) Write(record DeadLetterRecord) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		if err := os.MkdirAll(filepath.Dir(d.fileName), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(d.fileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		d.setFile(file)
+	}
+	return d.encoder.Encode(record)
+}
+
+func (d *deadLetterSink) setFile(file *os.File) {
+	d.file = file
+	d.writer = bufio.NewWriter(file)
+	d.encoder = json.NewEncoder(d.writer)
+	d.encoder.SetEscapeHTML(false)
+}
+
+// Flush writes the buffered records to the file and returns its size, 0 when no file was created
+func (d *deadLetterSink) Flush() (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return 0, nil
+	}
+	if err := d.writer.Flush(); err != nil {
+		return 0, err
+	}
+	return d.file.Seek(0, io.SeekCurrent)
+}
+
+// Close flushes and closes the dead-letter file, if one was created
+func (d *deadLetterSink) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return nil
+	}
+	err := d.writer.Flush()
+	if closeErr := d.file.Close(); err == nil {
+		err = closeErr
+	}
+	d.file = nil
+	return err
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	content := `{"spins": 1, "server_time": "a"}` + "\r\n" + `{"spins": "x"}` + "\n" + `{"spins": 2, "server_time": "b"}` + "\n" + `{broken` + "\n"
+	os.WriteFile(inputFileName, []byte(content), 0644)
+
+	deadLetterFileName := filepath.Join(dir, "rejected-{run}.ndjson")
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), 2, 10, 1, 1,
+		WithRunID("test"), WithDeadLetterFile(deadLetterFileName))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	if result.DeadLetterFile != filepath.Join(dir, "rejected-test.ndjson") {
+		t.Fatalf("Unexpected dead-letter file %q", result.DeadLetterFile)
+	}
+
+	file, err := os.Open(result.DeadLetterFile)
+	if err != nil {
+		t.Fatalf("Failed to open dead-letter file: %v", err)
+	}
+	defer file.Close()
+	records := map[int64]DeadLetterRecord{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record DeadLetterRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid dead-letter record %q: %v", scanner.Text(), err)
+		}
+		records[record.Line] = record
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 dead-letter records, got %v", records)
+	}
+	if record := records[2]; record.Offset != 34 || record.Data != `{"spins": "x"}` || record.Error == "" {
+		t.Errorf("Unexpected record for line 2: %+v", record)
+	}
+	if record := records[4]; record.Offset != 82 || record.Data != `{broken` {
+		t.Errorf("Unexpected record for line 4: %+v", record)
+	}
+}
+
+func TestExtractNoDeadLetterFileWithoutMalformedLines(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	os.WriteFile(inputFileName, []byte(`{"spins": 1, "server_time": "a"}`+"\n"), 0644)
+
+	deadLetterFileName := filepath.Join(dir, "rejected.ndjson")
+	parser, _ := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), 1, 10, 1, 1, WithDeadLetterFile(deadLetterFileName))
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	if result.DeadLetterFile != "" {
+		t.Errorf("Expected no dead-letter file, got %q", result.DeadLetterFile)
+	}
+	if _, err := os.Stat(deadLetterFileName); !os.IsNotExist(err) {
+		t.Errorf("Dead-letter file should not be created, stat returned %v", err)
+	}
+}
+
+func TestExtractMalformedThreshold(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	file, _ := os.Create(inputFileName)
+	for i := 0; i < 1000; i++ {
+		if i%10 == 0 {
+			file.WriteString("not json\n")
+		} else {
+			file.WriteString(`{"spins": 1, "server_time": "a"}` + "\n")
+		}
+	}
+	file.Close()
+
+	tests := []struct {
+		maxLines   int64
+		maxPercent float64
+		fails      bool
+	}{
+		{maxLines: 5, fails: true},
+		{maxLines: 100},
+		{maxPercent: 5, fails: true},
+		{maxPercent: 10},
+	}
+	for _, test := range tests {
+		parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), 2, 1000, 1, 1,
+			WithMalformedThreshold(test.maxLines, test.maxPercent))
+		if err != nil {
+			t.Fatalf("Failed to create extraction manager: %v", err)
+		}
+		_, err = parser.Extract(context.Background())
+		if test.fails && !errors.Is(err, ErrTooManyMalformed) {
+			t.Errorf("%+v: expected ErrTooManyMalformed, got %v", test, err)
+		}
+		if !test.fails && err != nil {
+			t.Errorf("%+v: unexpected error %v", test, err)
+		}
+	}
+}
+
+func TestExtractResumeTruncatesDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 1000)
+	checkpointFileName := filepath.Join(dir, "checkpoint.json")
+	deadLetterFileName := filepath.Join(dir, "rejected.ndjson")
+
+	newManager := func() *ExtractionManager {
+		parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "out", "output.csv"), 4, 100, 10, 10,
+			WithCheckpoint(checkpointFileName, 50), WithResume(), WithDeadLetterFile(deadLetterFileName))
+		if err != nil {
+			t.Fatalf("Failed to create extraction manager: %v", err)
+		}
+		return parser
+	}
+	reference, err := newManager().Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	expected, _ := os.ReadFile(deadLetterFileName)
+
+	// With a checkpoint the records are written in input order, lines 0, 33, 66, ...
+	records := bytes.SplitAfter(expected, []byte("\n"))
+	for i, data := range records[:len(records)-1] {
+		var record DeadLetterRecord
+		if err := json.Unmarshal(data, &record); err != nil || record.Line != int64(i*33+1) {
+			t.Fatalf("Record %d: expected line %d, got %+v, %v", i, i*33+1, record, err)
+		}
+	}
+
+	// Crash after line 400: the dead-letter file already holds records of lines after the checkpoint,
+	// see TestExtractResumeFromCheckpoint for the output files
+	input, _ := os.ReadFile(inputFileName)
+	rowsBefore := 400 - 400/33 - 1
+	fileIndex, fileRows := rowsBefore/100, rowsBefore%100
+	outputs := readFiles(t, reference.OutputFiles)
+	checkpoint := &Checkpoint{
+		RunID:          reference.RunID,
+		InputFile:      inputFileName,
+		InputOffset:    int64(bytes.Index(input, []byte(`{"spins": 400,`))),
+		LinesCommitted: 400,
+		OutputFiles:    reference.OutputFiles[:fileIndex+1],
+		FileIndex:      fileIndex,
+		FileRows:       fileRows,
+		FileSize:       int64(len(bytes.Join(bytes.SplitAfter(outputs[fileIndex], []byte("\n"))[:fileRows], nil))),
+		DeadLetterSize: int64(len(bytes.Join(records[:400/33+1], nil))),
+	}
+	if err := checkpoint.save(checkpointFileName); err != nil {
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+
+	resumed, err := newManager().Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Resumed extraction failed: %v", err)
+	}
+	if actual, _ := os.ReadFile(deadLetterFileName); resumed.DeadLetterFile != deadLetterFileName || !bytes.Equal(actual, expected) {
+		t.Errorf("Expected the dead-letter file of the reference run, got:\n%s", actual)
+	}
+
+	// A checkpoint taken before the first rejected line drops the file
+	checkpoint.InputOffset, checkpoint.LinesCommitted, checkpoint.FileIndex, checkpoint.DeadLetterSize = 0, 0, -1, 0
+	checkpoint.OutputFiles = nil
+	checkpoint.save(checkpointFileName)
+	if _, err := newManager().Extract(context.Background()); err != nil {
+		t.Fatalf("Resumed extraction failed: %v", err)
+	}
+	if actual, _ := os.ReadFile(deadLetterFileName); !bytes.Equal(actual, expected) {
+		t.Errorf("Expected the dead-letter file of the reference run, got:\n%s", actual)
+	}
+}
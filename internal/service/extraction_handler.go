@@ -1,96 +1,608 @@
 package service
 
 import (
+	"assignment/config"
 	"assignment/pkg/logger"
-	"bufio"
-	"encoding/csv"
-	"encoding/json"
+	"assignment/pkg/metrics"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
-	"log"
+	"io"
 	"math/rand"
 	"os"
-	"strconv"
+	"path/filepath"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-type Record struct {
-	Spins      int    `json:"spins"`
-	ServerTime string `json:"server_time"`
-}
-
 var (
-	successfulLines int
-	failedLines     int
+	ErrInvalidConfig = errors.New("invalid extraction configuration")
+	ErrOpenInput     = errors.New("error opening input file")
+	ErrReadInput     = errors.New("error reading input file")
+	ErrCreateOutput  = errors.New("error creating output file")
+	ErrWriteOutput   = errors.New("error writing output file")
+	// ErrTooManyMalformed is returned when the malformed lines exceed the configured threshold
+	ErrTooManyMalformed = errors.New("too many malformed lines")
 )
 
+// ExtractionResult describes how far an extraction run got
+type ExtractionResult struct {
+	RunID          string          `json:"runId"`
+	OutputFiles    []string        `json:"outputFiles"`
+	DeadLetterFile string          `json:"deadLetterFile,omitempty"` // Empty when no line was rejected or no dead-letter file is configured
+	ManifestFile   string          `json:"manifestFile,omitempty"`   // Empty unless the run completed and a manifest is configured
+	Stats          ExtractionStats `json:"stats"`
+	Interrupted    bool            `json:"interrupted"` // The run was cancelled before the whole input was read
+	Sources        []SourceStats   `json:"sources"`     // Counters of each input file, in the order the files are read
+}
+
 type ExtractionManager struct {
 	inputFileName  string
+	inputs         []string       // Input files, directories or globs, inputFileName unless configured
+	sources        []*inputSource // Input files of the current run
 	outputFileName string
-	numWorkers     int
-	linesPerFile   int           // Max Number of lines per output file
-	linesChannel   chan string   // buffered channel for lines
-	resultsChannel chan []string // Buffered channel for results
+	numWorkers     int              // Configured worker count, or Auto
+	workers        int              // Worker count the current run starts with
+	linesPerFile   int              // Max Number of lines per output file
+	linesChannel   chan inputLine   // buffered channel for lines
+	resultsChannel chan outputRow   // Buffered channel for results
+	stats          *ExtractionStats // Counters of the current run
+	columns        []Column         // Output columns, in order
+	outputFormat   string           // One of the Format* constants
+	writer         OutputWriter
+	template       *outputTemplate // Output file names, derived from outputFileName, nil when writing to stdout
+	toStdout       bool            // Write a single unrotated stream to standard output
+	runID          string          // Identifies the run in output file names
+	partitionKey   string          // Substituted for {partition} in output file names
+	startTime      time.Time       // Start of the current run
+
+	deadLetterFileName  string          // NDJSON file receiving malformed lines, disabled when empty
+	deadLetter          *deadLetterSink // Dead-letter file of the current run
+	maxMalformedLines   int64           // Abort once more lines are malformed, 0 disables the limit
+	maxMalformedPercent float64         // Fail when a larger share of the lines is malformed, 0 disables the limit
+	abort               context.CancelCauseFunc
+
+	manifestFileName string // Manifest written once a run completes, disabled when empty
+	serverTimeIndex  int    // Output column holding server_time, -1 when there is none
+
+	preserveOrder     bool           // Write rows in input order
+	reorderBufferSize int            // Max lines in flight when preserving order
+	reorder           *reorderBuffer // Reorder buffer of the current run
+
+	checkpointFileName string      // Progress is persisted to this file, disabled when empty
+	checkpointEvery    int64       // Committed lines between checkpoints
+	resume             bool        // Continue from the checkpoint file when it exists
+	maxLineSize        int         // Longer input lines are rejected, negative disables the limit
+	inputCompression   string      // One of the Compression* constants, detected when empty or CompressionAuto
+	resumeFrom         *Checkpoint // Checkpoint the current run continues from
+	inputParallelism   int         // Number of input files read at the same time
+
+	outputCompression      string // CompressionGzip, CompressionZstd, or empty for plain output files
+	outputCompressionLevel int    // 0 selects the default level of the compression
+	maxBytesPerFile        int64  // Rotate once the current file reaches this size, 0 disables the limit
+
+	linesChannelSize      int           // Configured capacity of linesChannel, or Auto
+	resultsChannelSize    int           // Configured capacity of resultsChannel, or Auto
+	runLinesChannelSize   int           // Capacity of linesChannel in the current run
+	runResultsChannelSize int           // Capacity of resultsChannel in the current run
+	adaptiveWorkers       bool          // Add and retire workers during the run, see adaptWorkers
+	adaptInterval         time.Duration // Sampling interval of adaptWorkers
+	retire                chan struct{} // Receiving from it stops a worker, nil unless workers adapt
 }
 
-func NewExtractionManager(inputFileName, outputFileName string, numWorkers, linesPerFile, linesChannelSize, resultsChannelSize int) *ExtractionManager {
+// RunID returns the identifier of the extraction run, substituted for {run} in output file names
+func (p *ExtractionManager) RunID() string {
+	return p.runID
+}
+
+func NewExtractionManager(inputFileName, outputFileName string, numWorkers, linesPerFile, linesChannelSize, resultsChannelSize int, opts ...Option) (*ExtractionManager, error) {
 	if inputFileName == "" || outputFileName == "" {
-		log.Fatalf("Input or output file name cannot be empty")
+		return nil, fmt.Errorf("%w: input or output file name cannot be empty", ErrInvalidConfig)
 	}
-	if numWorkers <= 0 || linesPerFile <= 0 || linesChannelSize <= 0 || resultsChannelSize <= 0 {
-		log.Fatalf("Configuration values must be greater than zero")
+	if !validSize(numWorkers, config.MaxWorkers) || linesPerFile <= 0 ||
+		!validSize(linesChannelSize, config.MaxChannelSize) || !validSize(resultsChannelSize, config.MaxChannelSize) {
+		return nil, fmt.Errorf("%w: configuration values must be greater than zero, with at most %d workers and channels of %d lines",
+			ErrInvalidConfig, config.MaxWorkers, config.MaxChannelSize)
 	}
 
-	return &ExtractionManager{
-		inputFileName:  inputFileName,
-		outputFileName: outputFileName,
-		numWorkers:     numWorkers,
-		linesPerFile:   linesPerFile,
-		linesChannel:   make(chan string, linesChannelSize),
-		resultsChannel: make(chan []string, resultsChannelSize),
+	p := &ExtractionManager{
+		inputFileName:      inputFileName,
+		inputs:             []string{inputFileName},
+		outputFileName:     outputFileName,
+		numWorkers:         numWorkers,
+		workers:            numWorkers,
+		linesPerFile:       linesPerFile,
+		linesChannelSize:   linesChannelSize,
+		resultsChannelSize: resultsChannelSize,
+		stats:              &ExtractionStats{},
+		columns:            DefaultColumns,
+		runID:              newRunID(time.Now()),
+		maxLineSize:        DefaultMaxLineSize,
+		inputParallelism:   1,
+		adaptInterval:      DefaultAdaptInterval,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if err := validateColumns(p.columns); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	writer, err := NewOutputWriter(p.outputFormat, p.columns)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	p.writer = writer
+	p.toStdout = outputFileName == StdioFileName
+	var template *outputTemplate
+	if !p.toStdout {
+		if template, err = parseOutputTemplate(outputFileName, writer.Extension()); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+	}
+	// A template ending with a compression extension selects that compression, or has to agree with it
+	implied := ""
+	if template != nil {
+		implied = templateCompression(outputFileName)
+	}
+	if implied != "" {
+		if p.outputCompression == "" {
+			p.outputCompression = implied
+		}
+		if p.outputCompression != implied {
+			return nil, fmt.Errorf("%w: output file name %q is %s compressed, not %s", ErrInvalidConfig, outputFileName, implied, p.outputCompression)
+		}
+	}
+	if err := validOutputCompression(p.outputCompression, p.outputCompressionLevel); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if p.outputCompression == CompressionNone {
+		p.outputCompression = ""
+	}
+	if p.outputCompression != "" {
+		if writer.Extension() == FormatParquet {
+			return nil, fmt.Errorf("%w: parquet output is compressed by the format itself", ErrInvalidConfig)
+		}
+		if template != nil && implied == "" {
+			template.appendExtension(outputCompressionExtensions[p.outputCompression])
+		}
+	}
+	if p.maxBytesPerFile < 0 {
+		return nil, fmt.Errorf("%w: max bytes per file cannot be negative", ErrInvalidConfig)
 	}
+	p.template = template
+	if p.deadLetterFileName != "" {
+		if hasIndex, err := validateTemplate(p.deadLetterFileName); err != nil || hasIndex {
+			return nil, fmt.Errorf("%w: invalid dead-letter file name %q", ErrInvalidConfig, p.deadLetterFileName)
+		}
+	}
+	if p.manifestFileName != "" {
+		if hasIndex, err := validateTemplate(p.manifestFileName); err != nil || hasIndex {
+			return nil, fmt.Errorf("%w: invalid manifest file name %q", ErrInvalidConfig, p.manifestFileName)
+		}
+		if p.toStdout {
+			return nil, fmt.Errorf("%w: a manifest needs output files, not standard output", ErrInvalidConfig)
+		}
+	}
+	p.serverTimeIndex = serverTimeColumn(p.columns)
+	if !validInputCompression(p.inputCompression) {
+		return nil, fmt.Errorf("%w: unknown input compression %q", ErrInvalidConfig, p.inputCompression)
+	}
+	if p.checkpointFileName != "" && (p.toStdout || slices.Contains(p.inputs, StdioFileName)) {
+		return nil, fmt.Errorf("%w: checkpoints need input and output files, not standard input or output", ErrInvalidConfig)
+	}
+	if p.toStdout && p.maxBytesPerFile > 0 {
+		return nil, fmt.Errorf("%w: standard output is not rotated", ErrInvalidConfig)
+	}
+	if p.checkpointFileName != "" {
+		// A checkpoint needs a contiguous prefix of the input to be committed, which requires ordered output
+		p.preserveOrder = true
+		if p.checkpointEvery <= 0 {
+			p.checkpointEvery = DefaultCheckpointEvery
+		}
+		if p.writer.Extension() == FormatParquet {
+			return nil, fmt.Errorf("%w: checkpoints are not supported for parquet output", ErrInvalidConfig)
+		}
+	} else if p.resume {
+		return nil, fmt.Errorf("%w: resume requires a checkpoint file", ErrInvalidConfig)
+	}
+	if len(p.inputs) == 0 {
+		return nil, fmt.Errorf("%w: no input files", ErrInvalidConfig)
+	}
+	if p.inputParallelism <= 0 {
+		return nil, fmt.Errorf("%w: input parallelism must be greater than zero", ErrInvalidConfig)
+	}
+	if p.inputParallelism > 1 && p.preserveOrder {
+		return nil, fmt.Errorf("%w: input files read in parallel have no order to preserve or checkpoint", ErrInvalidConfig)
+	}
+	if p.preserveOrder && p.reorderBufferSize <= 0 {
+		p.reorderBufferSize = DefaultReorderBufferSize
+	}
+	if p.reorderBufferSize > config.MaxChannelSize {
+		return nil, fmt.Errorf("%w: reorder buffer cannot hold more than %d lines", ErrInvalidConfig, config.MaxChannelSize)
+	}
+	if p.maxMalformedLines < 0 || p.maxMalformedPercent < 0 || p.maxMalformedPercent > 100 {
+		return nil, fmt.Errorf("%w: malformed line threshold out of range", ErrInvalidConfig)
+	}
+	return p, nil
 }
 
-// Extract reads the input file, processes it with multiple workers, and writes the results to output files.
-func (p *ExtractionManager) Extract() {
-	// Open input file
-	inputFile, err := os.Open(p.inputFileName)
+// Extract reads the input files, processes them with multiple workers, and writes the results to output files.
+// I/O failures are returned wrapping ErrOpenInput, ErrCreateOutput or ErrWriteOutput.
+// When ctx is cancelled reading stops, the lines already read are processed and written, the current
+// output file is flushed and closed, and the partial result is returned together with ctx.Err().
+// Runs of the same ExtractionManager must not overlap.
+func (p *ExtractionManager) Extract(ctx context.Context) (*ExtractionResult, error) {
+	p.startTime = time.Now()
+	p.stats = &ExtractionStats{}
+
+	// Resolve the input files, they are opened one by one as they are read
+	files, err := resolveInputs(p.inputs)
+	if err != nil {
+		metrics.RecordError(failureType(ErrOpenInput))
+		return nil, fmt.Errorf("%w: %w", ErrOpenInput, err)
+	}
+	p.sources = make([]*inputSource, len(files))
+	for i, file := range files {
+		p.sources[i] = &inputSource{index: i, stats: SourceStats{File: file}}
+	}
+
+	p.resumeFrom = nil
+	if p.resume {
+		if err := p.loadResumeCheckpoint(files); err != nil {
+			metrics.RecordError(failureType(err))
+			return nil, err
+		}
+	}
+
+	// The reader is also stopped when writing fails or too many lines are malformed
+	readCtx, stopReading := context.WithCancelCause(ctx)
+	defer stopReading(nil)
+
+	p.abort = stopReading
+	p.tuneRun(files)
+	p.linesChannel = make(chan inputLine, p.runLinesChannelSize)
+	p.resultsChannel = make(chan outputRow, p.runResultsChannelSize)
+	p.reorder = nil
+	if p.preserveOrder {
+		first := int64(1)
+		if p.resumeFrom != nil {
+			first = p.resumeFrom.LinesCommitted + 1
+		}
+		p.reorder = newReorderBuffer(p.reorderBufferSize, first)
+	}
+	p.deadLetter = nil
+	if p.deadLetterFileName != "" {
+		p.deadLetter = newDeadLetterSink(p.templateName(p.deadLetterFileName, 0))
+		if p.resumeFrom != nil {
+			if err := p.deadLetter.resume(p.resumeFrom.DeadLetterSize); err != nil {
+				err = fmt.Errorf("%w: dead-letter file: %w", ErrWriteOutput, err)
+				metrics.RecordError(failureType(err))
+				return nil, err
+			}
+		}
+	}
+
+	interrupted := false
+	readDone := make(chan struct{})
+	p.retire = nil
+	if p.adaptiveWorkers {
+		p.retire = make(chan struct{})
+	}
+	writeDone, reported := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(reported)
+		reportChannels(p.linesChannel, p.resultsChannel, writeDone)
+	}()
+	p.TriggerWorkers(p.linesChannel, p.resultsChannel, readDone)
+	p.readInputFiles(readCtx, p.linesChannel, &interrupted, readDone)
+	output, err := p.writeResults(p.resultsChannel)
+	if err != nil {
+		// Stop reading and let the workers finish so no goroutine is left blocked
+		stopReading(err)
+		for range p.resultsChannel {
+		}
+	}
+	close(writeDone)
+	<-reported
+
+	result := &ExtractionResult{
+		RunID:       p.runID,
+		OutputFiles: output.files,
+		Stats:       p.stats.Snapshot(),
+		Interrupted: interrupted && ctx.Err() != nil,
+		Sources:     make([]SourceStats, len(p.sources)),
+	}
+	for i, source := range p.sources {
+		result.Sources[i] = source.snapshot()
+	}
+	if p.deadLetter != nil {
+		if p.deadLetter.file != nil {
+			result.DeadLetterFile = p.deadLetter.fileName
+		}
+		if closeErr := p.deadLetter.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("%w: dead-letter file: %w", ErrWriteOutput, closeErr)
+		}
+	}
+	if err == nil && readCtx.Err() != nil && ctx.Err() == nil {
+		// A worker aborted the run
+		err = context.Cause(readCtx)
+	}
+	if err == nil {
+		err = p.checkMalformedPercent(result.Stats)
+	}
+	if err == nil && !result.Interrupted && p.manifestFileName != "" {
+		// Written last, once every output file is closed, so consumers can wait for the manifest
+		if result.ManifestFile, err = p.writeManifest(result, output); err != nil {
+			err = fmt.Errorf("%w: manifest: %w", ErrWriteOutput, err)
+		}
+	}
+	if p.checkpointFileName != "" && !errors.Is(err, ErrWriteOutput) && !errors.Is(err, ErrCreateOutput) {
+		// Keep the progress of unfinished runs so they can be resumed, completed runs need no checkpoint
+		if err == nil && !result.Interrupted {
+			if removeErr := os.Remove(p.checkpointFileName); removeErr != nil && !os.IsNotExist(removeErr) {
+				err = fmt.Errorf("%w: %w", ErrCheckpoint, removeErr)
+			}
+		} else if saveErr := p.saveCheckpoint(output); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}
 	if err != nil {
-		logger.Fatal("Error opening input file", logrus.Fields{"error": err})
+		metrics.RecordError(failureType(err))
+		logger.Error("Processing failed", logrus.Fields{"runId": p.runID, "error": err})
+		return result, err
 	}
-	defer inputFile.Close()
 
-	p.TriggerWorkers(p.linesChannel, p.resultsChannel)
-	p.readInputFile(inputFile, p.linesChannel)
-	p.writeResults(p.resultsChannel)
+	fields := result.Stats.Fields()
+	fields["inputFile"] = p.inputFileName
+	fields["outputFile"] = p.outputFileName
+	fields["runId"] = p.runID
+	fields["inputFiles"] = len(p.sources)
+	if result.ManifestFile != "" {
+		fields["manifestFile"] = result.ManifestFile
+	}
+	fields["duration"] = time.Since(p.startTime).String()
+	if p.resumeFrom != nil {
+		fields["resumedAtLine"] = p.resumeFrom.LinesCommitted
+	}
+	if result.Interrupted {
+		logger.Warning("Processing interrupted", fields)
+		return result, ctx.Err()
+	}
+	logger.Info("Processing completed", fields)
+	return result, nil
+}
 
-	logger.Info("Processing completed", logrus.Fields{
-		"inputFile":       p.inputFileName,
-		"outputFile":      p.outputFileName,
-		"successfulLines": successfulLines,
-		"failedLines":     failedLines,
+// loadResumeCheckpoint reads the checkpoint of a previous run, if there is one, so reading continues after
+// its last committed line. The run ID and start time of the previous run are reused so file names match.
+// Input files added after the checkpoint, such as new shards matching a glob, are read after the checkpointed ones.
+func (p *ExtractionManager) loadResumeCheckpoint(files []string) error {
+	checkpoint, err := loadCheckpoint(p.checkpointFileName)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidCheckpoint, err)
+	}
+	if checkpoint == nil {
+		logger.Info("No checkpoint found, starting from the beginning", logrus.Fields{"checkpointFile": p.checkpointFileName})
+		return nil
+	}
+	if checkpoint.InputFile != p.inputFileName {
+		return fmt.Errorf("%w: checkpoint is for input %q", ErrInvalidCheckpoint, checkpoint.InputFile)
+	}
+	if checkpoint.FileIndex >= len(checkpoint.OutputFiles) {
+		return fmt.Errorf("%w: output file %d is not listed", ErrInvalidCheckpoint, checkpoint.FileIndex)
+	}
+	if len(checkpoint.InputFiles) == 0 {
+		// Checkpoint of a single input file
+		checkpoint.InputFiles, checkpoint.InputSource, checkpoint.SourceLine = files[:1], 0, checkpoint.LinesCommitted
+	}
+	if checkpoint.InputSource < 0 || checkpoint.InputSource >= len(checkpoint.InputFiles) {
+		return fmt.Errorf("%w: input file %d is not listed", ErrInvalidCheckpoint, checkpoint.InputSource)
+	}
+	for i, file := range checkpoint.InputFiles[:checkpoint.InputSource+1] {
+		if i >= len(files) || files[i] != file {
+			return fmt.Errorf("%w: input file %q is no longer at position %d", ErrInvalidCheckpoint, file, i)
+		}
+	}
+
+	p.resumeFrom = checkpoint
+	p.runID = checkpoint.RunID
+	p.startTime = checkpoint.StartTime
+	logger.Info("Resuming from checkpoint", logrus.Fields{
+		"checkpointFile": p.checkpointFileName,
+		"line":           checkpoint.LinesCommitted,
+		"inputFile":      checkpoint.InputFiles[checkpoint.InputSource],
+		"offset":         checkpoint.InputOffset,
+		"outputFile":     checkpoint.FileIndex,
 	})
+	return nil
 }
 
-// Read input file line by line and send to workers
-func (p *ExtractionManager) readInputFile(inputFile *os.File, lines chan<- string) {
-	scanner := bufio.NewScanner(inputFile)
-	go func() {
-		for scanner.Scan() {
-			lines <- scanner.Text()
+// saveCheckpoint flushes the current output file and records the committed progress
+func (p *ExtractionManager) saveCheckpoint(output *outputState) error {
+	if output.current != nil && !output.closed {
+		if err := p.writer.Flush(); err != nil {
+			return fmt.Errorf("%w: %w", ErrWriteOutput, err)
 		}
-		close(lines)
+		// End the compressed member so the checkpointed file size is a point a resumed run can append at
+		if output.compressor != nil {
+			if err := output.compressor.EndMember(); err != nil {
+				return fmt.Errorf("%w: %w", ErrWriteOutput, err)
+			}
+		}
+	}
+	checkpoint := &Checkpoint{
+		RunID:          p.runID,
+		StartTime:      p.startTime,
+		InputFile:      p.inputFileName,
+		InputFiles:     make([]string, len(p.sources)),
+		InputSource:    output.committedSource,
+		SourceLine:     output.committedSourceLine,
+		InputOffset:    output.committedOffset,
+		LinesCommitted: output.committedLines,
+		OutputFiles:    output.files,
+		FileStats:      output.fileStats,
+		FileIndex:      len(output.files) - 1,
+		FileRows:       output.rows,
+	}
+	for i, source := range p.sources {
+		checkpoint.InputFiles[i] = source.stats.File
+	}
+	if output.current != nil {
+		checkpoint.FileSize = output.current.written
+	}
+	if p.deadLetter != nil {
+		size, err := p.deadLetter.Flush()
+		if err != nil {
+			return fmt.Errorf("%w: dead-letter file: %w", ErrWriteOutput, err)
+		}
+		checkpoint.DeadLetterSize = size
+	}
+	if err := checkpoint.save(p.checkpointFileName); err != nil {
+		return fmt.Errorf("%w: %w", ErrCheckpoint, err)
+	}
+	output.sinceCheckpoint = 0
+	return nil
+}
+
+// checkMalformedPercent fails the run when the share of malformed lines is above the configured percentage
+func (p *ExtractionManager) checkMalformedPercent(stats ExtractionStats) error {
+	if p.maxMalformedPercent == 0 || stats.LinesRead == 0 {
+		return nil
+	}
+	percent := float64(stats.LinesMalformed) * 100 / float64(stats.LinesRead)
+	if percent > p.maxMalformedPercent {
+		return fmt.Errorf("%w: %.2f%% of %d lines, limit is %.2f%%", ErrTooManyMalformed, percent, stats.LinesRead, p.maxMalformedPercent)
+	}
+	return nil
+}
+
+// inputLine is a line of the input together with its position
+type inputLine struct {
+	number int64        // 1-based position in the whole input, across input files
+	source *inputSource // Input file the line was read from
+	line   int64        // 1-based line number in the input file
+	offset int64        // byte offset of the start of the line in the input file
+	end    int64        // byte offset after the line and its line ending
+	data   string
+	err    error // set when the line could not be read in full, e.g. ErrLineTooLong
+}
+
+// readInputFiles reads the input files line by line and sends the lines to the workers, until the input ends
+// or ctx is cancelled. Files are read one after the other, or inputParallelism files at a time.
+// interrupted may only be read once the results channel is closed. done is closed together with lines.
+func (p *ExtractionManager) readInputFiles(ctx context.Context, lines chan<- inputLine, interrupted *bool, done chan<- struct{}) {
+	var number int64
+	first := 0
+	if p.resumeFrom != nil {
+		number, first = p.resumeFrom.LinesCommitted, p.resumeFrom.InputSource
+	}
+	pending := make(chan *inputSource, len(p.sources))
+	for _, source := range p.sources[first:] {
+		pending <- source
+	}
+	close(pending)
+
+	var wg sync.WaitGroup
+	var stopped atomic.Bool
+	for i := 0; i < p.inputParallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for source := range pending {
+				if !p.readInputFile(ctx, source, lines, &number) {
+					stopped.Store(true)
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(done)
+		defer close(lines)
+		defer p.stats.addDuration(&p.stats.ReadDuration, time.Now())
+		wg.Wait()
+		*interrupted = stopped.Load() && ctx.Err() != nil
 	}()
 }
 
+// readInputFile sends the lines of one input file to the workers, numbering them from number on.
+// It returns false when reading has to stop, because ctx is cancelled or the file cannot be read.
+func (p *ExtractionManager) readInputFile(ctx context.Context, source *inputSource, lines chan<- inputLine, number *int64) bool {
+	fileName := source.stats.File
+	input, err := p.openInput(fileName)
+	if err != nil {
+		p.abort(fmt.Errorf("%w: %w", ErrOpenInput, err))
+		return false
+	}
+	defer input.Close()
+
+	var line, offset int64
+	if p.resumeFrom != nil && source.index == p.resumeFrom.InputSource {
+		line, offset = p.resumeFrom.SourceLine, p.resumeFrom.InputOffset
+		if err := input.Skip(offset); err != nil {
+			p.abort(fmt.Errorf("%w: %s: %w", ErrOpenInput, fileName, err))
+			return false
+		}
+	}
+	reader := newLineReader(input, p.maxLineSize, offset)
+	read := readMetrics.lineCounter()
+	defer read.flush()
+	for {
+		readStart := time.Now()
+		data, start, end, lineErr, err := reader.Next()
+		if err == io.EOF {
+			if input.hash == nil {
+				return true
+			}
+			if source.fingerprint, err = input.fingerprint(fileName); err != nil {
+				p.abort(fmt.Errorf("%w: %s: %w", ErrReadInput, fileName, err))
+				return false
+			}
+			return true
+		}
+		if err != nil {
+			// Stop the run instead of silently treating a read failure as the end of the input
+			p.abort(fmt.Errorf("%w: %s line %d: %w", ErrReadInput, fileName, line+1, err))
+			return false
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		readMetrics.observe(readStart)
+		line++
+		seq := atomic.AddInt64(number, 1)
+		if p.reorder != nil && !p.reorder.acquire(ctx) {
+			return false
+		}
+		select {
+		case lines <- inputLine{number: seq, source: source, line: line, offset: start, end: end, data: string(data), err: lineErr}:
+			p.stats.add(&p.stats.LinesRead, 1)
+			p.stats.add(&source.stats.LinesRead, 1)
+			read.inc()
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
 // TriggerWorkers manages the worker goroutines,
 // ensuring they are started and that the results channel is closed when all workers are done.
-func (p *ExtractionManager) TriggerWorkers(lines chan string, results chan []string) {
+// With adaptive workers the pool is resized until readDone is closed.
+func (p *ExtractionManager) TriggerWorkers(lines chan inputLine, results chan outputRow, readDone <-chan struct{}) {
 	var wg sync.WaitGroup
 	// Start worker goroutines
-	for i := 0; i < p.numWorkers; i++ {
+	for i := 0; i < p.workers; i++ {
 		wg.Add(1)
-		go worker(lines, results, &wg)
+		go p.worker(lines, results, &wg)
+	}
+	if p.adaptiveWorkers {
+		// The tuner counts as a worker, so the results channel stays open while it may still add workers
+		wg.Add(1)
+		go p.adaptWorkers(lines, results, readDone, &wg)
 	}
 
 	// Start a goroutine to close the results channel after workers are done
@@ -101,63 +613,328 @@ func (p *ExtractionManager) TriggerWorkers(lines chan string, results chan []str
 }
 
 // responsible to process lines and send extracted data to the results channel
-func worker(lines chan string, results chan []string, wg *sync.WaitGroup) {
+func (p *ExtractionManager) worker(lines chan inputLine, results chan outputRow, wg *sync.WaitGroup) {
 	defer wg.Done()
-	for line := range lines {
-		var record Record
-		if err := json.Unmarshal([]byte(line), &record); err != nil {
-			failedLines++
-			logger.Warning("Malformed JSON skipped", logrus.Fields{
-				"error": err,
-			})
+	metrics.ActiveWorkers.Inc()
+	defer metrics.ActiveWorkers.Dec()
+	parsed := parseMetrics.lineCounter()
+	defer parsed.flush()
+	for {
+		var line inputLine
+		var ok bool
+		select {
+		case line, ok = <-lines:
+		case <-p.retire:
+			return
+		}
+		if !ok {
+			return
+		}
+		start := time.Now()
+		row, err := []string(nil), line.err
+		if err == nil {
+			row, err = extractRow([]byte(line.data), p.columns)
+		}
+		p.stats.addDuration(&p.stats.ParseDuration, start)
+		parseMetrics.observe(start)
+		if err != nil {
+			rejected := p.rejectLine(line, err)
+			if p.preserveOrder {
+				// Let the writer know this line will not produce a row
+				results <- outputRow{seq: line.number, source: line.source.index, line: line.line, end: line.end, rejected: rejected}
+			}
 			continue
 		}
-		successfulLines++
-		results <- []string{strconv.Itoa(record.Spins), record.ServerTime}
+		p.stats.add(&p.stats.LinesParsed, 1)
+		parsed.inc()
+		results <- outputRow{seq: line.number, source: line.source.index, line: line.line, end: line.end, row: row}
 	}
 }
 
-// writeResults listen to result channel and writes the processed results to CSV files.
-func (p *ExtractionManager) writeResults(results chan []string) {
-	fileIndex := 0
-	currentLineCount := 0
-	var outputFile *os.File
-	var writer *csv.Writer
+// rejectLine records a malformed line in the dead-letter file and aborts the run once the malformed line limit is exceeded.
+// When order is preserved the dead-letter record is returned instead, for the writer to write it in order.
+func (p *ExtractionManager) rejectLine(line inputLine, err error) *DeadLetterRecord {
+	malformed := p.stats.add(&p.stats.LinesMalformed, 1)
+	p.stats.add(&line.source.stats.LinesMalformed, 1)
+	if errors.Is(err, ErrLineTooLong) {
+		p.stats.add(&p.stats.LinesTooLong, 1)
+	}
+	metrics.RecordMalformed(malformedReason(err))
+	logger.Warning("Malformed JSON skipped", logrus.Fields{
+		"file":  line.source.stats.File,
+		"line":  line.line,
+		"error": err,
+	})
+
+	var rejected *DeadLetterRecord
+	if p.deadLetter != nil {
+		record := DeadLetterRecord{File: line.source.stats.File, Line: line.line, Offset: line.offset, Error: err.Error(), Data: line.data}
+		if p.preserveOrder {
+			rejected = &record
+		} else if writeErr := p.deadLetter.Write(record); writeErr != nil {
+			p.abort(fmt.Errorf("%w: dead-letter file: %w", ErrWriteOutput, writeErr))
+		}
+	}
+	if p.maxMalformedLines > 0 && malformed > p.maxMalformedLines {
+		p.abort(fmt.Errorf("%w: more than %d lines", ErrTooManyMalformed, p.maxMalformedLines))
+	}
+	return rejected
+}
 
-	for result := range results {
-		// Initialize the writer if it is nil
-		if writer == nil {
-			var err error
-			outputFileName := fmt.Sprintf("output-%d.csv", fileIndex)
-			outputFile, err = os.Create(outputFileName)
+// outputState tracks the output files of a run and how much of the input they hold
+type outputState struct {
+	files               []string
+	fileStats           []ManifestFile         // Rows and server_time range of each file, counted for the manifest
+	rows                int                    // Rows in the current file
+	current             *countingWriteCloser   // Current file, nil before the first one is opened
+	compressor          *compressedWriteCloser // Compression of the current file, nil for plain output
+	closed              bool                   // The current file has been flushed and closed
+	committedLines      int64                  // Number of the last line written or rejected, in order-preserving mode
+	committedSource     int                    // Input file of the last committed line
+	committedSourceLine int64                  // Line number of the last committed line in its input file
+	committedOffset     int64                  // Input file offset after the last committed line
+	sinceCheckpoint     int64
+}
+
+// writeResults listen to result channel and writes the processed results to output files.
+// It returns the output state, which lists the files it created.
+func (p *ExtractionManager) writeResults(results chan outputRow) (*outputState, error) {
+	output := &outputState{}
+	if p.resumeFrom != nil {
+		if err := p.reopenOutput(output, p.resumeFrom); err != nil {
+			return output, err
+		}
+	}
+
+	written := writeMetrics.lineCounter()
+	defer written.flush()
+	writeRow := func(row []string) error {
+		start := time.Now()
+		defer p.stats.addDuration(&p.stats.WriteDuration, start)
+		defer writeMetrics.observe(start)
+
+		// Open the first file, or rotate to a new one once the current file is full
+		if output.current == nil || (!p.toStdout && (output.rows == p.linesPerFile || p.fileSizeReached(output))) {
+			outputFileName, outputFile, err := p.createOutputFile(len(output.files))
 			if err != nil {
-				logger.Fatal("Error creating output file", logrus.Fields{"error": err})
+				return fmt.Errorf("%w: %w", ErrCreateOutput, err)
+			}
+			previous := output.current
+			dst := p.setCurrentFile(output, outputFile)
+			if previous != nil {
+				metrics.OutputRotations.Inc()
+				err = p.writer.Rotate(dst)
+				finishFile(&output.fileStats[len(output.fileStats)-1], previous)
+			} else {
+				err = p.writer.Open(dst)
 			}
-			writer = csv.NewWriter(outputFile)
-			fileIndex++
+			output.files = append(output.files, outputFileName)
+			output.fileStats = append(output.fileStats, ManifestFile{Name: outputFileName})
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrWriteOutput, err)
+			}
+			output.rows = 0
 		}
 
 		// Write the result to the current file
-		if err := writer.Write(result); err != nil {
-			logger.Error("Error writing to output file", logrus.Fields{"error": err})
-			return
+		if err := p.writer.Write(row); err != nil {
+			return fmt.Errorf("%w: %w", ErrWriteOutput, err)
+		}
+		output.rows++
+		p.countRow(&output.fileStats[len(output.fileStats)-1], row)
+		p.stats.add(&p.stats.LinesWritten, 1)
+		written.inc()
+		return nil
+	}
+
+	commit := func(result outputRow) error {
+		if result.row != nil {
+			if err := writeRow(result.row); err != nil {
+				return err
+			}
 		}
-		currentLineCount++
+		if result.rejected != nil {
+			if err := p.deadLetter.Write(*result.rejected); err != nil {
+				return fmt.Errorf("%w: dead-letter file: %w", ErrWriteOutput, err)
+			}
+		}
+		output.committedLines, output.committedOffset = result.seq, result.end
+		output.committedSource, output.committedSourceLine = result.source, result.line
+		if p.checkpointFileName == "" {
+			return nil
+		}
+		output.sinceCheckpoint++
+		if output.sinceCheckpoint >= p.checkpointEvery {
+			return p.saveCheckpoint(output)
+		}
+		return nil
+	}
 
-		// Open a new file if needed
-		if currentLineCount == p.linesPerFile {
-			writer.Flush()
-			outputFile.Close()
-			writer = nil // Reset writer to trigger reinitialization
-			currentLineCount = 0
+	for result := range results {
+		if p.reorder == nil {
+			if err := commit(result); err != nil {
+				// current is kept, the checkpoint saved for the failed run records its size
+				output.closed = true
+				p.writer.Close()
+				return output, err
+			}
+			continue
+		}
+		for _, ready := range p.reorder.push(result) {
+			if err := commit(ready); err != nil {
+				output.closed = true
+				p.writer.Close()
+				return output, err
+			}
 		}
 	}
 
 	// Flush and close the last file
-	if writer != nil {
-		writer.Flush()
+	start := time.Now()
+	defer p.stats.addDuration(&p.stats.WriteDuration, start)
+	output.closed = true
+	if err := p.writer.Close(); err != nil {
+		return output, fmt.Errorf("%w: %w", ErrWriteOutput, err)
+	}
+	if output.current != nil {
+		finishFile(&output.fileStats[len(output.fileStats)-1], output.current)
+	}
+	return output, nil
+}
+
+// finishFile records the size and the checksum of a closed output file for the manifest
+func finishFile(stats *ManifestFile, file *countingWriteCloser) {
+	if file.hash != nil {
+		stats.Bytes, stats.SHA256 = file.written, hex.EncodeToString(file.hash.Sum(nil))
+	}
+}
+
+// reopenOutput continues writing the output file of a checkpoint, dropping anything written after the checkpoint
+func (p *ExtractionManager) reopenOutput(output *outputState, checkpoint *Checkpoint) error {
+	output.committedLines, output.committedOffset = checkpoint.LinesCommitted, checkpoint.InputOffset
+	output.committedSource, output.committedSourceLine = checkpoint.InputSource, checkpoint.SourceLine
+	if checkpoint.FileIndex < 0 {
+		return nil
+	}
+	output.files = append(output.files, checkpoint.OutputFiles[:checkpoint.FileIndex+1]...)
+	output.rows = checkpoint.FileRows
+	output.fileStats = checkpoint.FileStats
+	if len(output.fileStats) != len(output.files) {
+		// Checkpoint written without file statistics: earlier files are counted as full, which is off when
+		// maxBytesPerFile rotated them, and their server_time ranges are unknown
+		output.fileStats = make([]ManifestFile, len(output.files))
+		for i, file := range output.files {
+			output.fileStats[i] = ManifestFile{Name: file, Rows: int64(p.linesPerFile)}
+		}
+		output.fileStats[checkpoint.FileIndex].Rows = int64(checkpoint.FileRows)
+	}
+
+	outputFile, err := os.OpenFile(output.files[checkpoint.FileIndex], os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCreateOutput, err)
+	}
+	if err := outputFile.Truncate(checkpoint.FileSize); err != nil {
 		outputFile.Close()
+		return fmt.Errorf("%w: %w", ErrWriteOutput, err)
+	}
+	// The checksum continues from the kept part of the file, which is read up to the end
+	file := p.newOutputFile(outputFile)
+	file.written = checkpoint.FileSize
+	if file.hash != nil {
+		_, err = io.CopyN(file.hash, outputFile, checkpoint.FileSize)
+	} else {
+		_, err = outputFile.Seek(checkpoint.FileSize, io.SeekStart)
+	}
+	if err != nil {
+		outputFile.Close()
+		return fmt.Errorf("%w: %w", ErrWriteOutput, err)
+	}
+	dst := p.setCurrentFile(output, file)
+	if err := p.writer.Open(dst); err != nil {
+		dst.Close()
+		return fmt.Errorf("%w: %w", ErrWriteOutput, err)
 	}
+	return nil
+}
+
+// countRow counts a row written to an output file, and its server_time when a manifest is written
+func (p *ExtractionManager) countRow(file *ManifestFile, row []string) {
+	file.Rows++
+	if p.manifestFileName == "" || p.serverTimeIndex < 0 {
+		return
+	}
+	if t, ok := parseServerTime(row[p.serverTimeIndex]); ok {
+		file.add(t)
+	}
+}
+
+// setCurrentFile makes file the current output file and returns the destination for the output writer,
+// which compresses into the file when output compression is enabled
+func (p *ExtractionManager) setCurrentFile(output *outputState, file *countingWriteCloser) io.WriteCloser {
+	output.current, output.compressor = file, nil
+	if p.outputCompression == "" {
+		return file
+	}
+	output.compressor = newCompressedWriteCloser(file, p.outputCompression, p.outputCompressionLevel)
+	return output.compressor
+}
+
+// fileSizeReached reports whether the current output file holds at least maxBytesPerFile bytes.
+// Only bytes that reached the file count, so files exceed the limit by up to what the output writer
+// and the compressor buffer.
+func (p *ExtractionManager) fileSizeReached(output *outputState) bool {
+	return p.maxBytesPerFile > 0 && output.current != nil && output.rows > 0 && output.current.written >= p.maxBytesPerFile
+}
+
+// createOutputFile creates the output file for the given rotation index, including missing directories.
+// When writing to standard output it returns standard output, which is never closed.
+func (p *ExtractionManager) createOutputFile(fileIndex int) (string, *countingWriteCloser, error) {
+	if p.toStdout {
+		return StdioFileName, &countingWriteCloser{writer: nopWriteCloser{os.Stdout}, stats: p.stats, counter: &p.stats.BytesOut}, nil
+	}
+	outputFileName := p.template.Name(fileIndex, p.templateValues())
+	if err := os.MkdirAll(filepath.Dir(outputFileName), 0755); err != nil {
+		return outputFileName, nil, err
+	}
+	outputFile, err := os.Create(outputFileName)
+	if err != nil {
+		return outputFileName, nil, err
+	}
+	p.stats.add(&p.stats.FilesCreated, 1)
+	return outputFileName, p.newOutputFile(outputFile), nil
+}
+
+// newOutputFile counts the bytes written to an output file, and checksums them when a manifest is written
+func (p *ExtractionManager) newOutputFile(file *os.File) *countingWriteCloser {
+	w := &countingWriteCloser{writer: file, stats: p.stats, counter: &p.stats.BytesOut}
+	if p.manifestFileName != "" {
+		w.hash = sha256.New()
+	}
+	return w
+}
+
+// nopWriteCloser is a writer whose Close does nothing
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// templateValues returns the values substituted into file name templates for the current run
+func (p *ExtractionManager) templateValues() templateValues {
+	return templateValues{
+		runID:     p.runID,
+		startTime: p.startTime,
+		partition: p.partitionKey,
+		input:     inputBaseName(p.inputs[0]),
+	}
+}
+
+// templateName expands a file name template for the current run
+func (p *ExtractionManager) templateName(pattern string, index int) string {
+	return expandTemplate(pattern, index, p.templateValues())
 }
 
 // input {"apple": 1, "banana":2}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"assignment/pkg/logger"
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -10,7 +11,7 @@ import (
 )
 
 func TestPerformanceParse(t *testing.T) {
-	logger.InitLogger() // Initialize the logger
+	logger.InitLogger(logger.LogConfig{Level: "info"}) // Initialize the logger
 
 	inputFileName := "performance_test_input.json"
 	outputFileName := "output-%d.csv"
@@ -23,11 +24,17 @@ func TestPerformanceParse(t *testing.T) {
 	linesChannelSize := 100
 	resultsChannelSize := 100
 
-	parser := NewExtractionManager(inputFileName, outputFileName, numWorkers, linesPerFile, linesChannelSize, resultsChannelSize)
+	parser, err := NewExtractionManager(inputFileName, outputFileName, numWorkers, linesPerFile, linesChannelSize, resultsChannelSize)
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
 
 	startTime := time.Now()
-	parser.Extract()
+	_, err = parser.Extract(context.Background())
 	elapsedTime := time.Since(startTime)
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
 
 	outputFiles := 0
 	for i := 0; ; i++ {
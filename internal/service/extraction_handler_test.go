@@ -1,44 +1,59 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
-	"time"
 )
 
 func TestWorker(t *testing.T) {
-	lines := make(chan string, 1)
-	results := make(chan []string, 1)
+	lines := make(chan inputLine, 1)
+	results := make(chan outputRow, 1)
 
-	lines <- `{"spins": 10, "server_time": "2025-05-24 00:00:01.99999 UTC"}`
+	lines <- inputLine{number: 1, source: &inputSource{}, line: 1, data: `{"spins": 10, "server_time": "2025-05-24 00:00:01.99999 UTC"}`}
 	close(lines)
 
+	parser, err := NewExtractionManager("test_input.json", "output-%d.csv", 1, 1, 1, 1)
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go worker(lines, results, &wg)
+	go parser.worker(lines, results, &wg)
 	wg.Wait()
 	close(results)
 
-	result := <-results
+	result := (<-results).row
 	if result[0] != "10" || result[1] != "2025-05-24 00:00:01.99999 UTC" {
 		t.Errorf("Worker failed to parse JSON correctly, got %v", result)
 	}
 }
 
 func TestWriteResults(t *testing.T) {
-	results := make(chan []string, 1)
-	results <- []string{"10", "2025-05-24 00:00:01.99999 UTC"}
+	results := make(chan outputRow, 1)
+	results <- outputRow{seq: 1, row: []string{"10", "2025-05-24 00:00:01.99999 UTC"}}
 	close(results)
 
-	parser := NewExtractionManager("test_input.json", "output-%d.csv", 1, 1, 1, 1)
-	go parser.writeResults(results) // Ensure the method is invoked
+	parser, err := NewExtractionManager("test_input.json", "output-%d.csv", 1, 1, 1, 1)
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	output, err := parser.writeResults(results)
 	outputFileName := "output-0.csv"
 	defer os.Remove(outputFileName) // Ensure the file is removed after the test
-
-	// Wait for the file to be created
-	time.Sleep(100 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("writeResults failed: %v", err)
+	}
+	if len(output.files) != 1 || output.files[0] != outputFileName {
+		t.Errorf("Expected output files [%s], got %v", outputFileName, output.files)
+	}
 
 	file, err := os.Open(outputFileName)
 	if err != nil {
@@ -56,3 +71,137 @@ func TestWriteResults(t *testing.T) {
 		t.Errorf("Output file content mismatch, expected '%s', got '%s'", expected, string(content))
 	}
 }
+
+func TestNewExtractionManagerInvalidConfig(t *testing.T) {
+	if _, err := NewExtractionManager("", "output.csv", 1, 1, 1, 1); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for an empty input file name, got %v", err)
+	}
+	if _, err := NewExtractionManager("input.json", "output.csv", 0, 1, 1, 1); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for zero workers, got %v", err)
+	}
+	if _, err := NewExtractionManager("input.json", "output.csv", 1, 1, 1, 1, WithOutputFormat("xml")); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for an unknown format, got %v", err)
+	}
+}
+
+func TestExtractMissingInput(t *testing.T) {
+	parser, err := NewExtractionManager("missing_input.json", "output-%d.csv", 1, 1, 1, 1)
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	if _, err := parser.Extract(context.Background()); !errors.Is(err, ErrOpenInput) {
+		t.Errorf("Expected ErrOpenInput, got %v", err)
+	}
+}
+
+func TestExtractCreateOutputFailure(t *testing.T) {
+	inputFileName := filepath.Join(t.TempDir(), "input.json")
+	os.WriteFile(inputFileName, []byte(`{"spins": 1, "server_time": "now"}`+"\n"), 0644)
+
+	// A regular file where the output directory should be makes file creation fail
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	os.WriteFile(blocker, nil, 0644)
+
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(blocker, "output.csv"), 1, 1, 1, 1)
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	if _, err := parser.Extract(context.Background()); !errors.Is(err, ErrCreateOutput) {
+		t.Errorf("Expected ErrCreateOutput, got %v", err)
+	}
+}
+
+func TestExtractCancelled(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	generateLargeInputFile(inputFileName, 10000)
+
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), 2, 1000, 1, 1)
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := parser.Extract(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if !result.Interrupted || result.Stats.LinesRead >= 10000 {
+		t.Errorf("Expected an interrupted partial run, got %+v", result)
+	}
+	if result.Stats.LinesWritten != result.Stats.LinesRead {
+		t.Errorf("Lines read before cancellation were not drained: %+v", result.Stats)
+	}
+}
+
+func TestExtractStats(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	content := `{"spins": 1, "server_time": "a"}` + "\n" + `not json` + "\n" + `{"spins": 2, "server_time": "b"}` + "\n"
+	os.WriteFile(inputFileName, []byte(content), 0644)
+
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), 2, 1, 1, 1)
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	// Counters belong to a run, a second run must not accumulate the first one
+	for run := 0; run < 2; run++ {
+		result, err := parser.Extract(context.Background())
+		if err != nil {
+			t.Fatalf("Extraction failed: %v", err)
+		}
+		stats := result.Stats
+		if stats.LinesRead != 3 || stats.LinesParsed != 2 || stats.LinesMalformed != 1 || stats.LinesWritten != 2 {
+			t.Errorf("Run %d: unexpected line counters %+v", run, stats)
+		}
+		if stats.FilesCreated != 2 || len(result.OutputFiles) != 2 {
+			t.Errorf("Run %d: expected 2 output files, got %+v", run, result)
+		}
+		if stats.BytesIn != int64(len(content)) || stats.BytesOut != int64(len("1,a\n2,b\n")) {
+			t.Errorf("Run %d: unexpected byte counters %+v", run, stats)
+		}
+	}
+}
+
+func TestExtractStdinToStdout(t *testing.T) {
+	dir := t.TempDir()
+	var content strings.Builder
+	for i := 0; i < 25; i++ {
+		fmt.Fprintf(&content, `{"spins": %d, "server_time": "t"}`+"\n", i)
+	}
+	stdin, _ := os.Create(filepath.Join(dir, "stdin"))
+	stdin.WriteString(content.String())
+	stdin.Seek(0, io.SeekStart)
+	stdout, _ := os.Create(filepath.Join(dir, "stdout"))
+	defer stdin.Close()
+	defer stdout.Close()
+
+	savedStdin, savedStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, stdout
+	defer func() { os.Stdin, os.Stdout = savedStdin, savedStdout }()
+
+	// Standard output is a single stream, linesPerFile does not rotate it
+	parser, err := NewExtractionManager(StdioFileName, StdioFileName, 2, 10, 1, 1, WithPreserveOrder(0))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	if len(result.OutputFiles) != 1 || result.OutputFiles[0] != StdioFileName || result.Stats.LinesWritten != 25 {
+		t.Errorf("Expected 25 rows written to stdout, got %+v", result)
+	}
+	output, _ := os.ReadFile(stdout.Name())
+	if lines := strings.Split(strings.TrimSpace(string(output)), "\n"); len(lines) != 25 || lines[24] != "24,t" {
+		t.Errorf("Unexpected stdout content %q", output)
+	}
+
+	if _, err := NewExtractionManager(StdioFileName, "output.csv", 1, 1, 1, 1, WithCheckpoint("checkpoint.json", 0)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected checkpoints of stdin to be rejected, got %v", err)
+	}
+	if _, err := NewExtractionManager("input.json", StdioFileName, 1, 1, 1, 1, WithMaxBytesPerFile(1024)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected a byte limit on stdout to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/ulikunitz/xz"
+)
+
+// Input compressions, CompressionAuto detects the compression from the content of the file
+const (
+	CompressionAuto  = "auto"
+	CompressionNone  = "none"
+	CompressionGzip  = "gzip"
+	CompressionZstd  = "zstd"
+	CompressionBzip2 = "bzip2"
+	CompressionXz    = "xz"
+)
+
+// StdioFileName as input file name reads standard input, as output file name it writes a single unrotated
+// stream to standard output
+const StdioFileName = "-"
+
+var compressionMagic = []struct {
+	compression string
+	magic       []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CompressionBzip2, []byte("BZh")},
+	{CompressionXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+var compressionExtensions = map[string]string{
+	".gz":   CompressionGzip,
+	".zst":  CompressionZstd,
+	".zstd": CompressionZstd,
+	".bz2":  CompressionBzip2,
+	".xz":   CompressionXz,
+}
+
+// validInputCompression reports whether the compression can be used for input files
+func validInputCompression(compression string) bool {
+	switch compression {
+	case "", CompressionAuto, CompressionNone, CompressionGzip, CompressionZstd, CompressionBzip2, CompressionXz:
+		return true
+	}
+	return false
+}
+
+// detectCompression identifies the compression from the magic bytes at the start of the file,
+// falling back to the file extension when the file is too short to tell
+func detectCompression(header []byte, fileName string) string {
+	for _, m := range compressionMagic {
+		if bytes.HasPrefix(header, m.magic) {
+			return m.compression
+		}
+	}
+	if len(header) < len(compressionMagic[len(compressionMagic)-1].magic) {
+		if compression, ok := compressionExtensions[strings.ToLower(filepath.Ext(fileName))]; ok {
+			return compression
+		}
+	}
+	return CompressionNone
+}
+
+// inputStream is the decompressed content of an input file.
+// Raw bytes read from the file are counted in the run statistics, and checksummed when hash is set.
+type inputStream struct {
+	file        *os.File
+	stats       *ExtractionStats
+	raw         *bufio.Reader
+	reader      io.Reader
+	closeReader func()
+	compression string
+	hash        hash.Hash // SHA-256 of the raw bytes, nil unless a manifest is written
+}
+
+// openInput opens an input file, or standard input for StdioFileName, and sets up streaming decompression
+func (p *ExtractionManager) openInput(fileName string) (*inputStream, error) {
+	file := os.Stdin
+	if fileName != StdioFileName {
+		var err error
+		if file, err = os.Open(fileName); err != nil {
+			return nil, err
+		}
+	}
+	input := &inputStream{file: file, stats: p.stats}
+	if p.manifestFileName != "" && fileName != StdioFileName {
+		input.hash = sha256.New()
+	}
+	input.raw = bufio.NewReaderSize(&countingReader{reader: file, stats: p.stats, counter: &p.stats.BytesIn, hash: input.hash}, 64*1024)
+
+	input.compression = p.inputCompression
+	if input.compression == "" || input.compression == CompressionAuto {
+		header, _ := input.raw.Peek(6)
+		input.compression = detectCompression(header, fileName)
+	}
+	if err := input.startDecoder(); err != nil {
+		input.closeFile()
+		return nil, fmt.Errorf("%s input: %w", input.compression, err)
+	}
+	return input, nil
+}
+
+func (in *inputStream) startDecoder() error {
+	switch in.compression {
+	case CompressionNone:
+		in.reader = in.raw
+	case CompressionGzip:
+		// pgzip decompresses ahead of the reader in a separate goroutine
+		reader, err := pgzip.NewReader(in.raw)
+		if err != nil {
+			return err
+		}
+		in.reader, in.closeReader = reader, func() { reader.Close() }
+	case CompressionZstd:
+		reader, err := zstd.NewReader(in.raw)
+		if err != nil {
+			return err
+		}
+		in.reader, in.closeReader = reader, reader.Close
+	case CompressionBzip2:
+		in.reader = bzip2.NewReader(in.raw)
+	case CompressionXz:
+		reader, err := xz.NewReader(in.raw)
+		if err != nil {
+			return err
+		}
+		in.reader = reader
+	default:
+		return fmt.Errorf("unknown compression %q", in.compression)
+	}
+	return nil
+}
+
+func (in *inputStream) Read(b []byte) (int, error) {
+	return in.reader.Read(b)
+}
+
+// Skip positions the stream at the given offset of the decompressed content.
+// Uncompressed files are seeked, or read into the checksum when there is one, compressed ones have to be
+// decompressed up to the offset.
+func (in *inputStream) Skip(offset int64) error {
+	if in.compression == CompressionNone {
+		if in.hash == nil {
+			if _, err := in.file.Seek(offset, io.SeekStart); err != nil {
+				return err
+			}
+		} else {
+			// Bytes already buffered by the header detection are hashed again, the checksum starts over
+			in.hash.Reset()
+			if _, err := in.file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			if skipped, err := io.CopyN(in.hash, in.file, offset); err != nil {
+				if err == io.EOF {
+					return fmt.Errorf("input ends after %d bytes, before offset %d", skipped, offset)
+				}
+				return err
+			}
+		}
+		in.raw.Reset(&countingReader{reader: in.file, stats: in.stats, counter: &in.stats.BytesIn, hash: in.hash})
+		return nil
+	}
+	skipped, err := io.CopyN(io.Discard, in.reader, offset)
+	if err == io.EOF {
+		return fmt.Errorf("input ends after %d bytes, before offset %d", skipped, offset)
+	}
+	return err
+}
+
+// fingerprint reads the rest of the raw file, which the decompressor may have left, and returns the
+// fingerprint of the file. It is only called once the stream reached its end with a checksum.
+func (in *inputStream) fingerprint(fileName string) (*InputFingerprint, error) {
+	if _, err := io.Copy(io.Discard, in.raw); err != nil {
+		return nil, err
+	}
+	info, err := in.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &InputFingerprint{File: fileName, Bytes: info.Size(), ModTime: info.ModTime().UTC(), SHA256: hex.EncodeToString(in.hash.Sum(nil))}, nil
+}
+
+func (in *inputStream) Close() error {
+	if in.closeReader != nil {
+		in.closeReader()
+	}
+	return in.closeFile()
+}
+
+// closeFile closes the input file, standard input is left open
+func (in *inputStream) closeFile() error {
+	if in.file == os.Stdin {
+		return nil
+	}
+	return in.file.Close()
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// SourceStats holds the counters of one input file of a run
+type SourceStats struct {
+	File           string `json:"file"`
+	LinesRead      int64  `json:"linesRead"`
+	LinesMalformed int64  `json:"linesMalformed"`
+}
+
+// inputSource is one input file of a run, identified by its position in the resolved input list
+type inputSource struct {
+	index       int
+	stats       SourceStats       // Counters are updated atomically
+	fingerprint *InputFingerprint // Set once the file is read to its end when a manifest is written
+}
+
+func (s *inputSource) snapshot() SourceStats {
+	return SourceStats{
+		File:           s.stats.File,
+		LinesRead:      atomic.LoadInt64(&s.stats.LinesRead),
+		LinesMalformed: atomic.LoadInt64(&s.stats.LinesMalformed),
+	}
+}
+
+// resolveInputs expands input patterns into the list of input files, in the order they are read.
+// A pattern is either a file, a directory, whose regular files are read in name order skipping hidden files,
+// or a glob, whose matching files are read in name order, or StdioFileName for standard input.
+// A file matched by several patterns is read once.
+func resolveInputs(patterns []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := expandInputPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no input files found", pattern)
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
+
+func expandInputPattern(pattern string) ([]string, error) {
+	if pattern == StdioFileName {
+		return []string{pattern}, nil
+	}
+	if strings.ContainsAny(pattern, "*?[") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+		var files []string
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+				files = append(files, match)
+			}
+		}
+		return files, nil
+	}
+
+	info, err := os.Stat(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{pattern}, nil
+	}
+	entries, err := os.ReadDir(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			files = append(files, filepath.Join(pattern, entry.Name()))
+		}
+	}
+	return files, nil
+}
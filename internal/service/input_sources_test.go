@@ -0,0 +1,211 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeShard writes numLines input lines, line i holding spins+i, with every 10th line malformed
+func writeShard(t *testing.T, fileName string, numLines int, spins int) {
+	t.Helper()
+	var content bytes.Buffer
+	for i := 1; i <= numLines; i++ {
+		if i%10 == 0 {
+			content.WriteString("not json\n")
+			continue
+		}
+		fmt.Fprintf(&content, `{"spins": %d, "server_time": "t"}`+"\n", spins+i)
+	}
+	if err := os.WriteFile(fileName, content.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+}
+
+func TestResolveInputs(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "shards"), 0755)
+	os.Mkdir(filepath.Join(dir, "shards", "nested"), 0755)
+	for _, name := range []string{"shards/b.json", "shards/a.json", "shards/.hidden", "single.json", "other.log"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+
+	files, err := resolveInputs([]string{
+		filepath.Join(dir, "single.json"),
+		filepath.Join(dir, "shards"),
+		filepath.Join(dir, "*.json"),
+	})
+	if err != nil {
+		t.Fatalf("resolveInputs failed: %v", err)
+	}
+	expected := []string{
+		filepath.Join(dir, "single.json"),
+		filepath.Join(dir, "shards", "a.json"),
+		filepath.Join(dir, "shards", "b.json"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+
+	for _, pattern := range []string{filepath.Join(dir, "missing.json"), filepath.Join(dir, "*.csv"), filepath.Join(dir, "shards", "nested")} {
+		if _, err := resolveInputs([]string{pattern}); err == nil {
+			t.Errorf("Expected %s to resolve to no input files", pattern)
+		}
+	}
+}
+
+func TestExtractMultipleInputFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "shards"), 0755)
+	writeShard(t, filepath.Join(dir, "shards", "00.json"), 25, 0)
+	writeShard(t, filepath.Join(dir, "shards", "01.json"), 15, 100)
+	extra := filepath.Join(dir, "extra.json")
+	writeShard(t, extra, 10, 200)
+
+	parser, err := NewExtractionManager("shards", filepath.Join(dir, "output.csv"), 2, 100, 10, 10,
+		WithInputFiles(filepath.Join(dir, "shards"), extra), WithPreserveOrder(0),
+		WithDeadLetterFile(filepath.Join(dir, "rejected.ndjson")))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+
+	expectedSources := []SourceStats{
+		{File: filepath.Join(dir, "shards", "00.json"), LinesRead: 25, LinesMalformed: 2},
+		{File: filepath.Join(dir, "shards", "01.json"), LinesRead: 15, LinesMalformed: 1},
+		{File: extra, LinesRead: 10, LinesMalformed: 1},
+	}
+	if !reflect.DeepEqual(result.Sources, expectedSources) {
+		t.Errorf("Expected sources %+v, got %+v", expectedSources, result.Sources)
+	}
+	if result.Stats.LinesRead != 50 || result.Stats.LinesWritten != 46 {
+		t.Errorf("Unexpected stats %+v", result.Stats)
+	}
+
+	// Rows of all files end up in one output, in input order
+	output := readFiles(t, result.OutputFiles)[0]
+	rows := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if rows[0] != "1,t" || rows[23] != "101,t" || rows[len(rows)-1] != "209,t" {
+		t.Errorf("Unexpected output order: %v", rows)
+	}
+
+	// Malformed lines are reported with their line number in their own file
+	file, err := os.Open(result.DeadLetterFile)
+	if err != nil {
+		t.Fatalf("Failed to open dead-letter file: %v", err)
+	}
+	defer file.Close()
+	var reported []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record DeadLetterRecord
+		json.Unmarshal(scanner.Bytes(), &record)
+		reported = append(reported, fmt.Sprintf("%s:%d", filepath.Base(record.File), record.Line))
+	}
+	expectedReported := []string{"00.json:10", "00.json:20", "01.json:10", "extra.json:10"}
+	if !reflect.DeepEqual(reported, expectedReported) {
+		t.Errorf("Expected dead-letter records %v, got %v", expectedReported, reported)
+	}
+}
+
+func TestExtractInputFilesInParallel(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		writeShard(t, filepath.Join(dir, fmt.Sprintf("shard-%d.json", i)), 200, i*1000)
+	}
+
+	parser, err := NewExtractionManager(filepath.Join(dir, "shard-*.json"), filepath.Join(dir, "out", "output.csv"), 4, 1000, 10, 10,
+		WithInputParallelism(3))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	var rows []string
+	for _, output := range readFiles(t, result.OutputFiles) {
+		rows = append(rows, strings.Split(strings.TrimSpace(string(output)), "\n")...)
+	}
+	if len(rows) != 5*180 || result.Stats.LinesRead != 1000 {
+		t.Fatalf("Expected 900 rows of 1000 lines, got %d rows, %+v", len(rows), result.Stats)
+	}
+	sort.Strings(rows)
+	for i := 1; i < len(rows); i++ {
+		if rows[i] == rows[i-1] {
+			t.Fatalf("Row %s written twice", rows[i])
+		}
+	}
+
+	if _, err := NewExtractionManager("input.json", "output.csv", 1, 1, 1, 1, WithInputParallelism(2), WithPreserveOrder(0)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected parallel input with preserved order to be rejected, got %v", err)
+	}
+}
+
+func TestExtractResumeInSecondInputFile(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "00.json"), filepath.Join(dir, "01.json")
+	writeShard(t, first, 30, 0)
+	writeShard(t, second, 30, 100)
+	checkpointFileName := filepath.Join(dir, "checkpoint.json")
+	outputFileName := filepath.Join(dir, "out", "output.csv")
+
+	newManager := func() *ExtractionManager {
+		parser, err := NewExtractionManager(dir, outputFileName, 2, 20, 10, 10,
+			WithInputFiles(first, second), WithCheckpoint(checkpointFileName, 5), WithResume())
+		if err != nil {
+			t.Fatalf("Failed to create extraction manager: %v", err)
+		}
+		return parser
+	}
+	reference, err := newManager().Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	expected := readFiles(t, reference.OutputFiles)
+
+	// Checkpoint after line 12 of the second file: 27 + 11 rows were written, 20 to the first output file
+	input, _ := os.ReadFile(second)
+	offset := int64(bytes.Index(input, []byte(`{"spins": 113,`)))
+	fileSize := int64(len(bytes.Join(bytes.SplitAfter(expected[1], []byte("\n"))[:18], nil)))
+	os.WriteFile(reference.OutputFiles[1], expected[1][:fileSize], 0644)
+	checkpoint := &Checkpoint{
+		RunID:          reference.RunID,
+		InputFile:      dir,
+		InputFiles:     []string{first, second},
+		InputSource:    1,
+		SourceLine:     12,
+		InputOffset:    offset,
+		LinesCommitted: 42,
+		OutputFiles:    reference.OutputFiles[:2],
+		FileIndex:      1,
+		FileRows:       18,
+		FileSize:       fileSize,
+	}
+	if err := checkpoint.save(checkpointFileName); err != nil {
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+
+	resumed, err := newManager().Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Resumed extraction failed: %v", err)
+	}
+	if resumed.Sources[0].LinesRead != 0 || resumed.Sources[1].LinesRead != 18 {
+		t.Errorf("Expected to resume at line 13 of the second file, got %+v", resumed.Sources)
+	}
+	if actual := readFiles(t, resumed.OutputFiles); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Output differs after resume")
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const compressedTestInput = `{"spins": 1, "server_time": "a"}` + "\n" + `{"spins": 2, "server_time": "b"}` + "\n"
+
+// compressedTestInput compressed with bzip2, the standard library has no bzip2 writer
+var bzip2TestInput = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x24, 0xde, 0x81, 0x5b, 0x00, 0x00,
+	0x1f, 0x5b, 0x80, 0x00, 0x10, 0x50, 0x04, 0x30, 0x10, 0x00, 0x00, 0xb2, 0x23, 0x5d, 0x0a, 0x20,
+	0x00, 0x40, 0x55, 0x53, 0x4d, 0x34, 0x18, 0x40, 0x7a, 0x85, 0x03, 0x4d, 0x0c, 0x8c, 0x98, 0x90,
+	0xd9, 0x44, 0x96, 0x78, 0xd4, 0x86, 0x31, 0x6b, 0xd1, 0x73, 0xd4, 0x9d, 0xa1, 0x54, 0x21, 0xf1,
+	0x37, 0x24, 0x37, 0x21, 0x54, 0x26, 0xfc, 0x5d, 0xc9, 0x14, 0xe1, 0x42, 0x40, 0x93, 0x7a, 0x05,
+	0x6c,
+}
+
+func compressTestInput(t *testing.T, compression string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch compression {
+	case CompressionNone:
+		return []byte(compressedTestInput)
+	case CompressionBzip2:
+		return bzip2TestInput
+	case CompressionGzip:
+		writer = gzip.NewWriter(&buffer)
+	case CompressionZstd:
+		writer, _ = zstd.NewWriter(&buffer)
+	case CompressionXz:
+		writer, _ = xz.NewWriter(&buffer)
+	}
+	writer.Write([]byte(compressedTestInput))
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func TestExtractCompressedInput(t *testing.T) {
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd, CompressionBzip2, CompressionXz} {
+		dir := t.TempDir()
+		// The extension is deliberately misleading, detection relies on the content
+		inputFileName := filepath.Join(dir, "input.jsonl")
+		os.WriteFile(inputFileName, compressTestInput(t, compression), 0644)
+
+		parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), 1, 10, 1, 1)
+		if err != nil {
+			t.Fatalf("Failed to create extraction manager: %v", err)
+		}
+		result, err := parser.Extract(context.Background())
+		if err != nil {
+			t.Fatalf("%s: extraction failed: %v", compression, err)
+		}
+		output, _ := os.ReadFile(result.OutputFiles[0])
+		if string(output) != "1,a\n2,b\n" {
+			t.Errorf("%s: unexpected output %q", compression, output)
+		}
+	}
+}
+
+func TestInputStreamSkip(t *testing.T) {
+	for _, compression := range []string{CompressionNone, CompressionGzip} {
+		inputFileName := filepath.Join(t.TempDir(), "input.jsonl")
+		os.WriteFile(inputFileName, compressTestInput(t, compression), 0644)
+
+		parser, _ := NewExtractionManager(inputFileName, "output.csv", 1, 10, 1, 1)
+		input, err := parser.openInput(inputFileName)
+		if err != nil {
+			t.Fatalf("%s: failed to open input: %v", compression, err)
+		}
+		if err := input.Skip(33); err != nil {
+			t.Fatalf("%s: skip failed: %v", compression, err)
+		}
+		rest, _ := io.ReadAll(input)
+		input.Close()
+		if string(rest) != `{"spins": 2, "server_time": "b"}`+"\n" {
+			t.Errorf("%s: unexpected content after skip %q", compression, rest)
+		}
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	if compression := detectCompression(nil, "input.jsonl.zst"); compression != CompressionZstd {
+		t.Errorf("Expected the extension to be used for an empty file, got %s", compression)
+	}
+	if compression := detectCompression([]byte(`{"spins"`), "input.jsonl.gz"); compression != CompressionNone {
+		t.Errorf("Expected the content to win over the extension, got %s", compression)
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxLineSize is the longest input line accepted when no limit is configured
+const DefaultMaxLineSize = 16 * 1024 * 1024
+
+// maxRejectedLinePrefix is how much of an over-long line is kept for error reporting
+const maxRejectedLinePrefix = 1024
+
+var ErrLineTooLong = errors.New("line exceeds the maximum line size")
+
+// lineReader splits its input into lines of any length, unlike bufio.Scanner which stops at 64 KB.
+// Lines longer than maxLineSize are not buffered in full: their remainder is discarded and they are
+// returned with an error so they take the malformed line path.
+type lineReader struct {
+	reader      *bufio.Reader
+	maxLineSize int   // A negative value disables the limit
+	offset      int64 // Offset of the next line
+	line        []byte
+}
+
+func newLineReader(input io.Reader, maxLineSize int, offset int64) *lineReader {
+	return &lineReader{
+		reader:      bufio.NewReaderSize(input, 64*1024),
+		maxLineSize: maxLineSize,
+		offset:      offset,
+	}
+}
+
+// Next returns the next line without its line ending and the byte offsets of its start and of the start
+// of the following line. lineErr is set for lines above the size limit, in which case only a prefix of the line
+// is returned. err is io.EOF at the end of the input, or the error of the underlying reader.
+func (r *lineReader) Next() (line []byte, start, end int64, lineErr, err error) {
+	start = r.offset
+	r.line = r.line[:0]
+	size := 0
+	tooLong := false
+
+	for {
+		chunk, readErr := r.reader.ReadSlice('\n')
+		size += len(chunk)
+		if !tooLong {
+			if r.maxLineSize >= 0 && size-trailingNewline(chunk) > r.maxLineSize {
+				tooLong = true
+				r.line = append(r.line, chunk...)
+				if len(r.line) > maxRejectedLinePrefix {
+					r.line = r.line[:maxRejectedLinePrefix]
+				}
+			} else {
+				r.line = append(r.line, chunk...)
+			}
+		}
+
+		if readErr == bufio.ErrBufferFull {
+			continue
+		}
+		r.offset += int64(size)
+		if readErr != nil && (readErr != io.EOF || size == 0) {
+			return nil, start, r.offset, nil, readErr
+		}
+		break
+	}
+
+	if tooLong {
+		return r.line, start, r.offset, fmt.Errorf("%w: %d bytes, limit is %d", ErrLineTooLong, size, r.maxLineSize), nil
+	}
+	return dropLineEnding(r.line), start, r.offset, nil, nil
+}
+
+func trailingNewline(chunk []byte) int {
+	if bytes.HasSuffix(chunk, []byte("\r\n")) {
+		return 2
+	}
+	if bytes.HasSuffix(chunk, []byte("\n")) {
+		return 1
+	}
+	return 0
+}
+
+func dropLineEnding(line []byte) []byte {
+	return line[:len(line)-trailingNewline(line)]
+}
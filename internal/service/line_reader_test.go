@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 200*1024)
+	input := "first\r\n\n" + long + "\nlast"
+	reader := newLineReader(strings.NewReader(input), -1, 0)
+
+	expected := []struct {
+		line       string
+		start, end int64
+	}{
+		{"first", 0, 7},
+		{"", 7, 8},
+		{long, 8, int64(9 + len(long))},
+		{"last", int64(9 + len(long)), int64(len(input))},
+	}
+	for _, e := range expected {
+		line, start, end, lineErr, err := reader.Next()
+		if err != nil || lineErr != nil {
+			t.Fatalf("Unexpected error: %v, %v", lineErr, err)
+		}
+		if string(line) != e.line || start != e.start || end != e.end {
+			t.Errorf("Expected %.10q at %d-%d, got %.10q at %d-%d", e.line, e.start, e.end, line, start, end)
+		}
+	}
+	if _, _, _, _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestLineReaderMaxLineSize(t *testing.T) {
+	input := "short\n" + strings.Repeat("y", 100*1024) + "\nafter\n"
+	reader := newLineReader(strings.NewReader(input), 1000, 0)
+
+	reader.Next()
+	line, _, end, lineErr, err := reader.Next()
+	if err != nil || !errors.Is(lineErr, ErrLineTooLong) {
+		t.Fatalf("Expected ErrLineTooLong, got %v, %v", lineErr, err)
+	}
+	if len(line) != maxRejectedLinePrefix || end != int64(6+100*1024+1) {
+		t.Errorf("Expected a %d byte prefix ending at %d, got %d bytes ending at %d", maxRejectedLinePrefix, 6+100*1024+1, len(line), end)
+	}
+	if line, _, _, _, _ := reader.Next(); string(line) != "after" {
+		t.Errorf("Reading must continue after an over-long line, got %q", line)
+	}
+}
+
+func TestExtractLongLines(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	padding := strings.Repeat("p", 100*1024)
+	content := `{"spins": 1, "server_time": "a", "padding": "` + padding + `"}` + "\n" +
+		`{"spins": 2, "server_time": "b", "padding": "` + padding + padding + `"}` + "\n" +
+		`{"spins": 3, "server_time": "c"}` + "\n"
+	os.WriteFile(inputFileName, []byte(content), 0644)
+
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), 2, 10, 1, 1,
+		WithMaxLineSize(150*1024), WithPreserveOrder(0))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	if result.Stats.LinesRead != 3 || result.Stats.LinesWritten != 2 || result.Stats.LinesTooLong != 1 {
+		t.Errorf("Expected the second line to be rejected as too long, got %+v", result.Stats)
+	}
+	output, _ := os.ReadFile(result.OutputFiles[0])
+	if string(output) != "1,a\n3,c\n" {
+		t.Errorf("Unexpected output %q", output)
+	}
+}
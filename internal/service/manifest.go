@@ -0,0 +1,169 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// serverTimeSource is the input field whose range is reported for each output file in the manifest
+const serverTimeSource = "server_time"
+
+// serverTimeLayouts are the accepted formats of server_time values, others are left out of the ranges
+var serverTimeLayouts = []string{"2006-01-02 15:04:05 MST", time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// Manifest describes a completed run. It is written once every output file is closed, so its presence
+// marks the output as complete.
+type Manifest struct {
+	RunID           string             `json:"runId"`
+	StartTime       time.Time          `json:"startTime"`
+	EndTime         time.Time          `json:"endTime"`
+	Format          string             `json:"format"`
+	Compression     string             `json:"compression,omitempty"`
+	Columns         []string           `json:"columns"`
+	Rows            int64              `json:"rows"` // Rows of all the files, including those written before a resume
+	Files           []ManifestFile     `json:"files"`
+	Inputs          []InputFingerprint `json:"inputs"`
+	DeadLetterFile  string             `json:"deadLetterFile,omitempty"`
+	Stats           ExtractionStats    `json:"stats"` // Counters of the last run only, when it was resumed
+	ServerTimeRange                    // Range of all the files
+}
+
+// ManifestFile is an output file of a run. Rows, the server_time range, Bytes and SHA256 are all computed
+// while the file is written.
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	ServerTimeRange
+}
+
+// ServerTimeRange is the range of the server_time values of some rows, empty when none could be parsed
+type ServerTimeRange struct {
+	MinServerTime *time.Time `json:"minServerTime,omitempty"`
+	MaxServerTime *time.Time `json:"maxServerTime,omitempty"`
+}
+
+// InputFingerprint identifies the content of an input file, standard input has none
+type InputFingerprint struct {
+	File    string    `json:"file"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	ModTime time.Time `json:"modTime,omitempty"`
+	SHA256  string    `json:"sha256,omitempty"`
+}
+
+// serverTimeColumn returns the index of the output column holding server_time, or -1
+func serverTimeColumn(columns []Column) int {
+	for i, column := range columns {
+		if column.Source == serverTimeSource {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseServerTime parses a server_time value in one of serverTimeLayouts
+func parseServerTime(value string) (time.Time, bool) {
+	for _, layout := range serverTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// add widens the range to include t
+func (r *ServerTimeRange) add(t time.Time) {
+	if r.MinServerTime == nil || t.Before(*r.MinServerTime) {
+		r.MinServerTime = &t
+	}
+	if r.MaxServerTime == nil || t.After(*r.MaxServerTime) {
+		r.MaxServerTime = &t
+	}
+}
+
+// merge widens the range to include another one
+func (r *ServerTimeRange) merge(other ServerTimeRange) {
+	if other.MinServerTime != nil {
+		r.add(*other.MinServerTime)
+		r.add(*other.MaxServerTime)
+	}
+}
+
+// writeManifest atomically writes the manifest of a completed run and returns the name of the manifest file.
+// The files were checksummed while they were read and written. Only those a resumed run did not go through,
+// the inputs before the one it resumed from and the outputs of a checkpoint without checksums, are read again.
+func (p *ExtractionManager) writeManifest(result *ExtractionResult, output *outputState) (string, error) {
+	manifest := Manifest{
+		RunID:          p.runID,
+		StartTime:      p.startTime.UTC(),
+		EndTime:        time.Now().UTC(),
+		Format:         p.writer.Extension(),
+		Compression:    p.outputCompression,
+		Columns:        make([]string, len(p.columns)),
+		Files:          make([]ManifestFile, len(output.fileStats)),
+		Inputs:         make([]InputFingerprint, len(p.sources)),
+		DeadLetterFile: result.DeadLetterFile,
+		Stats:          result.Stats,
+	}
+	for i, column := range p.columns {
+		manifest.Columns[i] = column.Name
+	}
+	for i, file := range output.fileStats {
+		if file.SHA256 == "" {
+			info, sum, err := checksum(file.Name)
+			if err != nil {
+				return "", err
+			}
+			file.Bytes, file.SHA256 = info.Size(), sum
+		}
+		manifest.Files[i] = file
+		manifest.Rows += file.Rows
+		manifest.ServerTimeRange.merge(file.ServerTimeRange)
+	}
+	for i, source := range p.sources {
+		manifest.Inputs[i] = InputFingerprint{File: source.stats.File}
+		if source.fingerprint != nil {
+			manifest.Inputs[i] = *source.fingerprint
+			continue
+		}
+		if source.stats.File == StdioFileName {
+			continue
+		}
+		info, sum, err := checksum(source.stats.File)
+		if err != nil {
+			return "", err
+		}
+		manifest.Inputs[i].Bytes, manifest.Inputs[i].ModTime, manifest.Inputs[i].SHA256 = info.Size(), info.ModTime().UTC(), sum
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	fileName := p.templateName(p.manifestFileName, 0)
+	return fileName, writeFileAtomic(fileName, data)
+}
+
+// checksum returns the information and the hex encoded SHA-256 of a file
+func checksum(fileName string) (os.FileInfo, string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", fileName, err)
+	}
+	return info, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readManifest(t *testing.T, fileName string) Manifest {
+	t.Helper()
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("Failed to read the manifest: %v", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("Invalid manifest: %v", err)
+	}
+	return manifest
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExtractWritesManifest(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 250)
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "out", "spins.csv"), 4, 100, 10, 10,
+		WithRunID("r1"), WithManifest(filepath.Join(dir, "out", "{run}.manifest.json")))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	if result.ManifestFile != filepath.Join(dir, "out", "r1.manifest.json") {
+		t.Fatalf("Unexpected manifest file %q", result.ManifestFile)
+	}
+
+	manifest := readManifest(t, result.ManifestFile)
+	if manifest.RunID != "r1" || manifest.Format != FormatCSV || manifest.Rows != result.Stats.LinesWritten || len(manifest.Columns) != 2 {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+	if len(manifest.Files) != 3 || len(result.OutputFiles) != 3 {
+		t.Fatalf("Expected 3 output files, got %+v", manifest.Files)
+	}
+	contents := readFiles(t, result.OutputFiles)
+	for i, file := range manifest.Files {
+		if file.Name != result.OutputFiles[i] || file.Bytes != int64(len(contents[i])) || file.SHA256 != sha256Hex(contents[i]) {
+			t.Errorf("File %d: unexpected entry %+v", i, file)
+		}
+		if lines := int64(bytes.Count(contents[i], []byte("\n"))); file.Rows != lines {
+			t.Errorf("File %d: expected %d rows, got %d", i, lines, file.Rows)
+		}
+		if file.MinServerTime == nil || file.MaxServerTime == nil || file.MinServerTime.After(*file.MaxServerTime) {
+			t.Errorf("File %d: unexpected server_time range %+v", i, file.ServerTimeRange)
+		}
+	}
+	// Lines 0, 33, ... are malformed, the others have server_time 00:00:(i%60)
+	minTime, maxTime := time.Date(2025, 5, 24, 0, 0, 0, 0, time.UTC), time.Date(2025, 5, 24, 0, 0, 59, 0, time.UTC)
+	if manifest.MinServerTime == nil || !manifest.MinServerTime.Equal(minTime) || !manifest.MaxServerTime.Equal(maxTime) {
+		t.Errorf("Expected server_time from %s to %s, got %+v", minTime, maxTime, manifest.ServerTimeRange)
+	}
+
+	input, _ := os.ReadFile(inputFileName)
+	if len(manifest.Inputs) != 1 || manifest.Inputs[0].File != inputFileName || manifest.Inputs[0].Bytes != int64(len(input)) ||
+		manifest.Inputs[0].SHA256 != sha256Hex(input) || manifest.Inputs[0].ModTime.IsZero() {
+		t.Errorf("Unexpected input fingerprint %+v", manifest.Inputs)
+	}
+}
+
+func TestExtractWritesNoManifestForFailedRuns(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 100)
+	manifestFileName := filepath.Join(dir, "manifest.json")
+
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), 2, 10, 1, 1,
+		WithManifest(manifestFileName), WithMalformedThreshold(0, 1))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if !errors.Is(err, ErrTooManyMalformed) {
+		t.Fatalf("Expected ErrTooManyMalformed, got %v", err)
+	}
+	if _, statErr := os.Stat(manifestFileName); !os.IsNotExist(statErr) || result.ManifestFile != "" {
+		t.Errorf("Expected no manifest for a failed run, stat returned %v", statErr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result, err = parser.Extract(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if _, statErr := os.Stat(manifestFileName); !os.IsNotExist(statErr) || result.ManifestFile != "" {
+		t.Errorf("Expected no manifest for an interrupted run, stat returned %v", statErr)
+	}
+}
+
+func TestManifestOfResumedRun(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 1000)
+	checkpointFileName := filepath.Join(dir, "checkpoint.json")
+	manifestFileName := filepath.Join(dir, "manifest.json")
+
+	newManager := func() *ExtractionManager {
+		parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "out", "output.csv"), 4, 100, 10, 10,
+			WithCheckpoint(checkpointFileName, 50), WithResume(), WithManifest(manifestFileName))
+		if err != nil {
+			t.Fatalf("Failed to create extraction manager: %v", err)
+		}
+		return parser
+	}
+	reference, err := newManager().Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	expected := readManifest(t, manifestFileName)
+	os.Remove(manifestFileName)
+
+	// Crash after line 400, in the middle of the fourth file, see TestExtractResumeFromCheckpoint
+	input, _ := os.ReadFile(inputFileName)
+	rowsBefore := 400 - 400/33 - 1
+	fileIndex, fileRows := rowsBefore/100, rowsBefore%100
+	contents := readFiles(t, reference.OutputFiles)
+	fileSize := int64(len(bytes.Join(bytes.SplitAfter(contents[fileIndex], []byte("\n"))[:fileRows], nil)))
+	fileStats := append([]ManifestFile(nil), expected.Files[:fileIndex+1]...)
+	// The first file is read again as the checkpoint has no checksum for it, the others keep theirs
+	fileStats[0].Bytes, fileStats[0].SHA256 = 0, ""
+	fileStats[fileIndex].Bytes, fileStats[fileIndex].SHA256 = 0, ""
+	fileStats[fileIndex].Rows = int64(fileRows)
+	checkpoint := &Checkpoint{
+		RunID:          reference.RunID,
+		StartTime:      expected.StartTime,
+		InputFile:      inputFileName,
+		InputOffset:    int64(bytes.Index(input, []byte(`{"spins": 400,`))),
+		LinesCommitted: 400,
+		OutputFiles:    reference.OutputFiles[:fileIndex+1],
+		FileStats:      fileStats,
+		FileIndex:      fileIndex,
+		FileRows:       fileRows,
+		FileSize:       fileSize,
+	}
+	if err := checkpoint.save(checkpointFileName); err != nil {
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+
+	resumed, err := newManager().Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Resumed extraction failed: %v", err)
+	}
+	manifest := readManifest(t, resumed.ManifestFile)
+	if manifest.Rows != expected.Rows || manifest.Stats.LinesRead != 600 || len(manifest.Files) != len(expected.Files) {
+		t.Fatalf("Expected the manifest to cover the whole output, got %+v", manifest)
+	}
+	for i, file := range manifest.Files {
+		if file.Name != expected.Files[i].Name || file.Rows != expected.Files[i].Rows || file.SHA256 != expected.Files[i].SHA256 ||
+			file.Bytes != expected.Files[i].Bytes ||
+			!file.MinServerTime.Equal(*expected.Files[i].MinServerTime) || !file.MaxServerTime.Equal(*expected.Files[i].MaxServerTime) {
+			t.Errorf("File %d: expected %+v, got %+v", i, expected.Files[i], file)
+		}
+	}
+	// The input was skipped up to the checkpoint, its checksum still covers the whole file
+	if len(manifest.Inputs) != 1 || manifest.Inputs[0] != expected.Inputs[0] {
+		t.Errorf("Expected the input fingerprint %+v, got %+v", expected.Inputs, manifest.Inputs)
+	}
+}
+
+func TestManifestChecksumsCompressedFiles(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 300)
+	content, _ := os.ReadFile(inputFileName)
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(content)
+	writer.Close()
+	os.WriteFile(inputFileName+".gz", compressed.Bytes(), 0644)
+
+	parser, err := NewExtractionManager(inputFileName+"*", filepath.Join(dir, "out", "spins.csv"), 4, 100, 10, 10,
+		WithOutputCompression(CompressionGzip, 0), WithManifest(filepath.Join(dir, "manifest.json")))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	manifest := readManifest(t, result.ManifestFile)
+	inputs := [][]byte{content, compressed.Bytes()}
+	if len(manifest.Inputs) != len(inputs) {
+		t.Fatalf("Expected 2 inputs, got %+v", manifest.Inputs)
+	}
+	for i, input := range manifest.Inputs {
+		if input.Bytes != int64(len(inputs[i])) || input.SHA256 != sha256Hex(inputs[i]) {
+			t.Errorf("Input %d: unexpected fingerprint %+v", i, input)
+		}
+	}
+	contents := readFiles(t, result.OutputFiles)
+	for i, file := range manifest.Files {
+		if file.Bytes != int64(len(contents[i])) || file.SHA256 != sha256Hex(contents[i]) {
+			t.Errorf("File %d: unexpected entry %+v", i, file)
+		}
+	}
+}
+
+func TestManifestConfiguration(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithManifest("manifest-{index}.json")},
+		{WithManifest("manifest-{day}.json")},
+	} {
+		if _, err := NewExtractionManager("input.json", "output.csv", 1, 1, 1, 1, opts...); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected the manifest file name to be rejected, got %v", err)
+		}
+	}
+	if _, err := NewExtractionManager("input.json", StdioFileName, 1, 1, 1, 1, WithManifest("manifest.json")); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected a manifest of standard output to be rejected, got %v", err)
+	}
+}
+
+func TestParseServerTime(t *testing.T) {
+	expected := time.Date(2025, 5, 24, 13, 4, 5, 123000000, time.UTC)
+	for _, value := range []string{"2025-05-24 13:04:05.123 UTC", "2025-05-24T15:04:05.123+02:00", "2025-05-24 13:04:05.123"} {
+		if actual, ok := parseServerTime(value); !ok || !actual.Equal(expected) {
+			t.Errorf("%q: expected %s, got %s, %t", value, expected, actual, ok)
+		}
+	}
+	if _, ok := parseServerTime("yesterday"); ok {
+		t.Error("Expected an invalid server_time to be left out")
+	}
+}
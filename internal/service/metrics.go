@@ -0,0 +1,170 @@
+package service
+
+import (
+	"assignment/pkg/metrics"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Pipeline stages, the operation and stage labels of the pipeline metrics
+const (
+	stageRead  = "read"
+	stageParse = "parse"
+	stageWrite = "write"
+)
+
+// Channel labels of the channel metrics
+const (
+	channelLines   = "lines"
+	channelResults = "results"
+)
+
+// metricsInterval is how often the channel occupancy is sampled during a run
+const metricsInterval = time.Second
+
+// lineBatch is the number of lines a goroutine counts before adding them to the line counter of its stage
+const lineBatch = 1024
+
+// stageMetrics are the metrics of a pipeline stage, resolved once as looking the labels up for every line
+// slows the pipeline down
+type stageMetrics struct {
+	duration prometheus.Observer
+	lines    prometheus.Counter
+}
+
+var (
+	readMetrics  = newStageMetrics(stageRead)
+	parseMetrics = newStageMetrics(stageParse)
+	writeMetrics = newStageMetrics(stageWrite)
+)
+
+func newStageMetrics(stage string) stageMetrics {
+	return stageMetrics{
+		duration: metrics.ProcessingDuration.WithLabelValues(stage),
+		lines:    metrics.LinesProcessed.WithLabelValues(stage),
+	}
+}
+
+// observe records the duration of an operation of the stage started at start
+func (m stageMetrics) observe(start time.Time) {
+	m.duration.Observe(time.Since(start).Seconds())
+}
+
+// lineCounter batches the lines counted by one goroutine, it is flushed once the goroutine is done
+func (m stageMetrics) lineCounter() *lineCounter {
+	return &lineCounter{counter: m.lines}
+}
+
+type lineCounter struct {
+	counter prometheus.Counter
+	pending int
+}
+
+func (c *lineCounter) inc() {
+	if c.pending++; c.pending == lineBatch {
+		c.flush()
+	}
+}
+
+func (c *lineCounter) flush() {
+	if c.pending > 0 {
+		c.counter.Add(float64(c.pending))
+		c.pending = 0
+	}
+}
+
+// malformedReason classifies why a line was rejected, for the malformed line counter
+func malformedReason(err error) string {
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.Is(err, ErrLineTooLong):
+		return "line_too_long"
+	case errors.Is(err, ErrMissingField):
+		return "missing_field"
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return "invalid_json"
+	case errors.As(err, new(*json.UnmarshalTypeError)):
+		return "not_an_object"
+	}
+	return "invalid_value"
+}
+
+// failureType classifies the error that ended a run, for the processing error counter
+func failureType(err error) string {
+	switch {
+	case errors.Is(err, ErrOpenInput):
+		return "open_input"
+	case errors.Is(err, ErrReadInput):
+		return "read_input"
+	case errors.Is(err, ErrCreateOutput):
+		return "create_output"
+	case errors.Is(err, ErrWriteOutput):
+		return "write_output"
+	case errors.Is(err, ErrCheckpoint), errors.Is(err, ErrInvalidCheckpoint):
+		return "checkpoint"
+	case errors.Is(err, ErrTooManyMalformed):
+		return "too_many_malformed"
+	}
+	return "other"
+}
+
+// reportChannels adds the capacity of the channels of a run to the channel gauges and samples their occupancy
+// until done is closed, then removes what it added. The gauges sum up the runs in progress, such as the jobs
+// of a pool, so a run finishing leaves the others in place.
+func reportChannels(lines chan inputLine, results chan outputRow, done <-chan struct{}) {
+	gauges := []*channelGauge{
+		newChannelGauge(channelLines, cap(lines), func() int { return len(lines) }),
+		newChannelGauge(channelResults, cap(results), func() int { return len(results) }),
+	}
+	ticker := time.NewTicker(metricsInterval)
+	defer ticker.Stop()
+	for {
+		for _, gauge := range gauges {
+			gauge.sample()
+		}
+		select {
+		case <-done:
+			for _, gauge := range gauges {
+				gauge.remove()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// channelGauge is the share of a run in the gauges of a channel
+type channelGauge struct {
+	capacity  prometheus.Gauge
+	occupancy prometheus.Gauge
+	size      float64
+	length    func() int
+	reported  float64 // Occupancy added to the gauge so far
+}
+
+func newChannelGauge(channel string, size int, length func() int) *channelGauge {
+	g := &channelGauge{
+		capacity:  metrics.ChannelCapacity.WithLabelValues(channel),
+		occupancy: metrics.ChannelOccupancy.WithLabelValues(channel),
+		size:      float64(size),
+		length:    length,
+	}
+	g.capacity.Add(g.size)
+	return g
+}
+
+// sample moves the occupancy gauge by the change of the length of the channel since the last sample
+func (g *channelGauge) sample() {
+	length := float64(g.length())
+	g.occupancy.Add(length - g.reported)
+	g.reported = length
+}
+
+func (g *channelGauge) remove() {
+	g.occupancy.Sub(g.reported)
+	g.capacity.Sub(g.size)
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"assignment/pkg/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMalformedReason(t *testing.T) {
+	for _, test := range []struct {
+		line     string
+		expected string
+	}{
+		{line: `not json`, expected: "invalid_json"},
+		{line: `{"spins": 1`, expected: "invalid_json"},
+		{line: `[1, 2]`, expected: "not_an_object"},
+		{line: `{"spins": "ten"}`, expected: "invalid_value"},
+	} {
+		_, err := extractRow([]byte(test.line), DefaultColumns)
+		if reason := malformedReason(err); reason != test.expected {
+			t.Errorf("%s: expected %s, got %s (%v)", test.line, test.expected, reason, err)
+		}
+	}
+	if reason := malformedReason(fmt.Errorf("%w: spins", ErrMissingField)); reason != "missing_field" {
+		t.Errorf("Expected missing_field, got %s", reason)
+	}
+	if reason := malformedReason(ErrLineTooLong); reason != "line_too_long" {
+		t.Errorf("Expected line_too_long, got %s", reason)
+	}
+	if failure := failureType(fmt.Errorf("%w: disk full", ErrWriteOutput)); failure != "write_output" {
+		t.Errorf("Expected write_output, got %s", failure)
+	}
+}
+
+func TestExtractReportsMetrics(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 100)
+
+	// The metrics are global, so compare them before and after the run
+	counters := map[string]func() float64{
+		"read":          func() float64 { return testutil.ToFloat64(metrics.LinesProcessed.WithLabelValues(stageRead)) },
+		"parsed":        func() float64 { return testutil.ToFloat64(metrics.LinesProcessed.WithLabelValues(stageParse)) },
+		"written":       func() float64 { return testutil.ToFloat64(metrics.LinesProcessed.WithLabelValues(stageWrite)) },
+		"invalid json":  func() float64 { return testutil.ToFloat64(metrics.MalformedLines.WithLabelValues("invalid_json")) },
+		"rotations":     func() float64 { return testutil.ToFloat64(metrics.OutputRotations) },
+		"open failures": func() float64 { return testutil.ToFloat64(metrics.ProcessingErrors.WithLabelValues("open_input")) },
+	}
+	before := map[string]float64{}
+	for name, counter := range counters {
+		before[name] = counter()
+	}
+
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output-{index}.csv"), 2, 40, 10, 10)
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	if _, err := parser.Extract(context.Background()); err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	missing, err := NewExtractionManager(filepath.Join(dir, "missing.json"), filepath.Join(dir, "missing.csv"), 1, 1, 1, 1)
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	if _, err := missing.Extract(context.Background()); !errors.Is(err, ErrOpenInput) {
+		t.Fatalf("Expected ErrOpenInput, got %v", err)
+	}
+
+	// 100 lines, 4 of them malformed, written to 3 files of 40 rows
+	expected := map[string]float64{"read": 100, "parsed": 96, "written": 96, "invalid json": 4, "rotations": 2, "open failures": 1}
+	for name, counter := range counters {
+		if delta := counter() - before[name]; delta != expected[name] {
+			t.Errorf("Expected %s to grow by %v, got %v", name, expected[name], delta)
+		}
+	}
+	if workers := testutil.ToFloat64(metrics.ActiveWorkers); workers != 0 {
+		t.Errorf("Expected no active workers after the run, got %v", workers)
+	}
+	if capacity := testutil.ToFloat64(metrics.ChannelCapacity.WithLabelValues(channelLines)); capacity != 0 {
+		t.Errorf("Expected the finished run to leave the lines channel capacity, got %v", capacity)
+	}
+}
+
+func TestReportChannelsAddsUpRuns(t *testing.T) {
+	capacity := func() float64 { return testutil.ToFloat64(metrics.ChannelCapacity.WithLabelValues(channelLines)) }
+	occupancy := func() float64 { return testutil.ToFloat64(metrics.ChannelOccupancy.WithLabelValues(channelLines)) }
+	waitFor := func(value func() float64, expected float64) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for value() != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %v, got %v", expected, value())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Two runs in progress, the first one with 3 lines queued
+	first, second := make(chan inputLine, 10), make(chan inputLine, 20)
+	for i := 0; i < 3; i++ {
+		first <- inputLine{}
+	}
+	firstDone, secondDone := make(chan struct{}), make(chan struct{})
+	firstStopped := make(chan struct{})
+	go func() {
+		reportChannels(first, make(chan outputRow, 1), firstDone)
+		close(firstStopped)
+	}()
+	go reportChannels(second, make(chan outputRow, 1), secondDone)
+	waitFor(capacity, 30)
+	waitFor(occupancy, 3)
+
+	// The first one finishing leaves the share of the second one
+	close(firstDone)
+	<-firstStopped
+	if capacity() != 20 || occupancy() != 0 {
+		t.Errorf("Expected the capacity of the second run only, got %v and %v queued", capacity(), occupancy())
+	}
+	close(secondDone)
+	waitFor(capacity, 0)
+}
@@ -0,0 +1,148 @@
+package service
+
+import "time"
+
+// Option configures optional behaviour of an ExtractionManager
+type Option func(*ExtractionManager)
+
+// WithColumns sets the ordered list of columns extracted from every input record
+func WithColumns(columns ...Column) Option {
+	return func(p *ExtractionManager) {
+		p.columns = columns
+	}
+}
+
+// WithOutputFormat selects the output file format, see the Format* constants
+func WithOutputFormat(format string) Option {
+	return func(p *ExtractionManager) {
+		p.outputFormat = format
+	}
+}
+
+// WithRunID overrides the generated run ID
+func WithRunID(runID string) Option {
+	return func(p *ExtractionManager) {
+		p.runID = runID
+	}
+}
+
+// WithPartitionKey sets the value of the {partition} output file name placeholder
+func WithPartitionKey(partitionKey string) Option {
+	return func(p *ExtractionManager) {
+		p.partitionKey = partitionKey
+	}
+}
+
+// WithDeadLetterFile writes every malformed line, with its line number, byte offset and parse error,
+// as NDJSON to the given file. The name accepts the output file name placeholders except {index}.
+func WithDeadLetterFile(fileName string) Option {
+	return func(p *ExtractionManager) {
+		p.deadLetterFileName = fileName
+	}
+}
+
+// WithManifest writes a JSON manifest to the given file once a run completes, listing every output file with
+// its rows, size, SHA-256 and server_time range, and the fingerprint of every input file. The manifest is
+// written last and atomically, so its presence marks the output as complete. The name accepts the output
+// file name placeholders except {index}.
+func WithManifest(fileName string) Option {
+	return func(p *ExtractionManager) {
+		p.manifestFileName = fileName
+	}
+}
+
+// WithMalformedThreshold fails the run when more than maxLines lines, or more than maxPercent percent of
+// the lines, are malformed. A zero value disables the corresponding limit.
+func WithMalformedThreshold(maxLines int64, maxPercent float64) Option {
+	return func(p *ExtractionManager) {
+		p.maxMalformedLines = maxLines
+		p.maxMalformedPercent = maxPercent
+	}
+}
+
+// WithPreserveOrder writes rows in the order of the input lines. At most bufferSize lines are held
+// between reading and writing, 0 selects DefaultReorderBufferSize.
+func WithPreserveOrder(bufferSize int) Option {
+	return func(p *ExtractionManager) {
+		p.preserveOrder = true
+		p.reorderBufferSize = bufferSize
+	}
+}
+
+// WithCheckpoint persists the progress of the run to fileName every `every` input lines, 0 selects
+// DefaultCheckpointEvery. Checkpointing implies order-preserving output. The checkpoint is removed
+// once the run completes.
+func WithCheckpoint(fileName string, every int64) Option {
+	return func(p *ExtractionManager) {
+		p.checkpointFileName = fileName
+		p.checkpointEvery = every
+	}
+}
+
+// WithResume continues the run recorded in the checkpoint file, when there is one, instead of starting over
+func WithResume() Option {
+	return func(p *ExtractionManager) {
+		p.resume = true
+	}
+}
+
+// WithMaxLineSize rejects input lines longer than maxLineSize bytes as malformed, without buffering them in full.
+// 0 selects DefaultMaxLineSize and a negative value accepts lines of any length.
+func WithMaxLineSize(maxLineSize int) Option {
+	return func(p *ExtractionManager) {
+		if maxLineSize == 0 {
+			maxLineSize = DefaultMaxLineSize
+		}
+		p.maxLineSize = maxLineSize
+	}
+}
+
+// WithInputCompression forces the compression of the input file instead of detecting it from its content,
+// see the Compression* constants
+func WithInputCompression(compression string) Option {
+	return func(p *ExtractionManager) {
+		p.inputCompression = compression
+	}
+}
+
+// WithOutputCompression compresses every output file with gzip or zstd at the given level, 0 selects the
+// default level. The compression extension is appended to the output file names.
+func WithOutputCompression(compression string, level int) Option {
+	return func(p *ExtractionManager) {
+		p.outputCompression = compression
+		p.outputCompressionLevel = level
+	}
+}
+
+// WithMaxBytesPerFile also rotates output files once they reach maxBytes bytes on disk, after compression
+func WithMaxBytesPerFile(maxBytes int64) Option {
+	return func(p *ExtractionManager) {
+		p.maxBytesPerFile = maxBytes
+	}
+}
+
+// WithInputFiles reads the given files, directories and globs, in order, as one input instead of inputFileName
+func WithInputFiles(patterns ...string) Option {
+	return func(p *ExtractionManager) {
+		p.inputs = patterns
+	}
+}
+
+// WithInputParallelism reads up to n input files at the same time. Rows of different files are then
+// interleaved, so reading in parallel cannot be combined with order-preserving output or checkpoints.
+func WithInputParallelism(n int) Option {
+	return func(p *ExtractionManager) {
+		p.inputParallelism = n
+	}
+}
+
+// WithAdaptiveWorkers adds and retires workers during the run, following the occupancy of the channels
+// sampled every interval, 0 selects DefaultAdaptInterval. See adaptWorkers.
+func WithAdaptiveWorkers(interval time.Duration) Option {
+	return func(p *ExtractionManager) {
+		p.adaptiveWorkers = true
+		if interval > 0 {
+			p.adaptInterval = interval
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// outputCompressionExtensions are the file extensions appended to compressed output files
+var outputCompressionExtensions = map[string]string{
+	CompressionGzip: ".gz",
+	CompressionZstd: ".zst",
+}
+
+// templateCompression returns the compression named by the extension of an output file name template,
+// empty when it names none. bzip2 and xz are returned too, validOutputCompression rejects them.
+func templateCompression(pattern string) string {
+	return compressionExtensions[strings.ToLower(filepath.Ext(pattern))]
+}
+
+// validOutputCompression checks an output compression and its level, 0 selects the default level
+func validOutputCompression(compression string, level int) error {
+	switch compression {
+	case "", CompressionNone:
+		return nil
+	case CompressionGzip:
+		if level < 0 || level > gzip.BestCompression {
+			return fmt.Errorf("gzip level %d out of range 1-%d", level, gzip.BestCompression)
+		}
+		return nil
+	case CompressionZstd:
+		if level < 0 || level > 22 {
+			return fmt.Errorf("zstd level %d out of range 1-22", level)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output compression %q", compression)
+}
+
+// compressedWriteCloser compresses everything written to it into an output file.
+// EndMember terminates the compressed stream written so far, the next write starts a new gzip member or
+// zstd frame. Decoders read the concatenation as a single stream, which lets a resumed run append to a file
+// truncated at a checkpoint.
+type compressedWriteCloser struct {
+	dst         io.WriteCloser
+	compression string
+	level       int
+	encoder     io.WriteCloser // Encoder of the current member, nil until the first write
+}
+
+func newCompressedWriteCloser(dst io.WriteCloser, compression string, level int) *compressedWriteCloser {
+	return &compressedWriteCloser{dst: dst, compression: compression, level: level}
+}
+
+func (w *compressedWriteCloser) Write(b []byte) (int, error) {
+	if w.encoder == nil {
+		encoder, err := w.newEncoder()
+		if err != nil {
+			return 0, err
+		}
+		w.encoder = encoder
+	}
+	return w.encoder.Write(b)
+}
+
+func (w *compressedWriteCloser) newEncoder() (io.WriteCloser, error) {
+	switch w.compression {
+	case CompressionGzip:
+		level := w.level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w.dst, level)
+	case CompressionZstd:
+		level := zstd.SpeedDefault
+		if w.level != 0 {
+			level = zstd.EncoderLevelFromZstd(w.level)
+		}
+		return zstd.NewWriter(w.dst, zstd.WithEncoderLevel(level))
+	}
+	return nil, fmt.Errorf("unknown output compression %q", w.compression)
+}
+
+// EndMember writes out everything buffered by the encoder and terminates the current member
+func (w *compressedWriteCloser) EndMember() error {
+	if w.encoder == nil {
+		return nil
+	}
+	err := w.encoder.Close()
+	w.encoder = nil
+	return err
+}
+
+func (w *compressedWriteCloser) Close() error {
+	err := w.EndMember()
+	if closeErr := w.dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
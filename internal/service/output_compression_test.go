@@ -0,0 +1,218 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func decompressFile(t *testing.T, fileName, compression string) []byte {
+	t.Helper()
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", fileName, err)
+	}
+	defer file.Close()
+
+	var reader io.Reader
+	switch compression {
+	case CompressionGzip:
+		reader, err = gzip.NewReader(file)
+	case CompressionZstd:
+		var decoder *zstd.Decoder
+		decoder, err = zstd.NewReader(file)
+		defer decoder.Close()
+		reader = decoder
+	}
+	if err != nil {
+		t.Fatalf("Failed to decompress %s: %v", fileName, err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to decompress %s: %v", fileName, err)
+	}
+	return data
+}
+
+func TestExtractCompressedOutput(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 1000)
+
+	reference, err := NewExtractionManager(inputFileName, filepath.Join(dir, "plain", "output.csv"), 1, 100, 10, 10)
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	plain, err := reference.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	expected := readFiles(t, plain.OutputFiles)
+
+	for _, test := range []struct {
+		compression string
+		level       int
+		extension   string
+	}{
+		{CompressionGzip, 0, ".csv.gz"},
+		{CompressionGzip, 9, ".csv.gz"},
+		{CompressionZstd, 0, ".csv.zst"},
+		{CompressionZstd, 19, ".csv.zst"},
+	} {
+		parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, test.compression, "output.csv"), 1, 100, 10, 10,
+			WithOutputCompression(test.compression, test.level))
+		if err != nil {
+			t.Fatalf("Failed to create extraction manager: %v", err)
+		}
+		result, err := parser.Extract(context.Background())
+		if err != nil {
+			t.Fatalf("%s: extraction failed: %v", test.compression, err)
+		}
+		if len(result.OutputFiles) != len(expected) {
+			t.Fatalf("%s: expected %d output files, got %d", test.compression, len(expected), len(result.OutputFiles))
+		}
+		for i, outputFile := range result.OutputFiles {
+			if !strings.HasSuffix(outputFile, test.extension) {
+				t.Errorf("%s: expected %s to end with %s", test.compression, outputFile, test.extension)
+			}
+			if !bytes.Equal(decompressFile(t, outputFile, test.compression), expected[i]) {
+				t.Errorf("%s: output file %d differs from the plain output", test.compression, i)
+			}
+		}
+	}
+}
+
+func TestExtractMaxBytesPerFile(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 50000)
+
+	// The compressor only writes complete blocks, so the limit has to be well above its block size
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv.gz"), 1, 50000, 10, 10,
+		WithOutputCompression(CompressionGzip, 1), WithMaxBytesPerFile(64*1024))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+	if len(result.OutputFiles) < 2 {
+		t.Fatalf("Expected the byte limit to rotate the output, got %v", result.OutputFiles)
+	}
+	rows := 0
+	for _, outputFile := range result.OutputFiles {
+		if strings.HasSuffix(outputFile, ".gz.gz") {
+			t.Errorf("Compression extension added twice to %s", outputFile)
+		}
+		rows += bytes.Count(decompressFile(t, outputFile, CompressionGzip), []byte("\n"))
+	}
+	if int64(rows) != result.Stats.LinesWritten {
+		t.Errorf("Expected %d rows across the files, got %d", result.Stats.LinesWritten, rows)
+	}
+}
+
+func TestCompressedWriteCloserAppendAfterMember(t *testing.T) {
+	for _, compression := range []string{CompressionGzip, CompressionZstd} {
+		fileName := filepath.Join(t.TempDir(), "output.csv")
+		file, _ := os.Create(fileName)
+		writer := newCompressedWriteCloser(file, compression, 0)
+		writer.Write([]byte("committed\n"))
+		if err := writer.EndMember(); err != nil {
+			t.Fatalf("%s: failed to end member: %v", compression, err)
+		}
+		size, _ := file.Seek(0, io.SeekCurrent)
+		writer.Write([]byte("lost after the checkpoint\n"))
+		writer.Close()
+
+		// A resumed run truncates the file at the checkpoint and appends a new member
+		file, _ = os.OpenFile(fileName, os.O_WRONLY, 0)
+		file.Truncate(size)
+		file.Seek(size, io.SeekStart)
+		writer = newCompressedWriteCloser(file, compression, 0)
+		writer.Write([]byte("resumed\n"))
+		if err := writer.Close(); err != nil {
+			t.Fatalf("%s: failed to close: %v", compression, err)
+		}
+
+		if data := decompressFile(t, fileName, compression); string(data) != "committed\nresumed\n" {
+			t.Errorf("%s: unexpected content %q", compression, data)
+		}
+	}
+}
+
+func TestOutputCompressionConfiguration(t *testing.T) {
+	for _, opt := range []Option{
+		WithOutputCompression("lz4", 0),
+		WithOutputCompression(CompressionGzip, 10),
+		WithOutputCompression(CompressionZstd, 23),
+		WithMaxBytesPerFile(-1),
+	} {
+		if _, err := NewExtractionManager("input.json", "output.csv", 1, 1, 1, 1, opt); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig, got %v", err)
+		}
+	}
+	if _, err := NewExtractionManager("input.json", "output", 1, 1, 1, 1, WithOutputFormat(FormatParquet), WithOutputCompression(CompressionGzip, 0)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected compressed parquet output to be rejected, got %v", err)
+	}
+	// The extension of the template has to agree with the compression
+	for _, test := range []struct {
+		outputFileName string
+		compression    string
+	}{
+		{"out/spins-{index}.csv.gz", CompressionNone},
+		{"out/spins-{index}.csv.gz", CompressionZstd},
+		{"out/spins-{index}.csv.zst", CompressionGzip},
+		{"out/spins-{index}.csv.bz2", ""},
+		{"out/spins-{index}.parquet.gz", ""},
+	} {
+		opts := []Option{WithOutputCompression(test.compression, 0)}
+		if strings.Contains(test.outputFileName, FormatParquet) {
+			opts = append(opts, WithOutputFormat(FormatParquet))
+		}
+		if _, err := NewExtractionManager("input.json", test.outputFileName, 1, 1, 1, 1, opts...); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s with %q compression: expected ErrInvalidConfig, got %v", test.outputFileName, test.compression, err)
+		}
+	}
+}
+
+func TestOutputCompressionFromTemplate(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	writeCheckpointInput(t, inputFileName, 250)
+
+	for _, test := range []struct {
+		outputFileName string
+		compression    string
+	}{
+		{"spins-{index}.csv.gz", CompressionGzip},
+		{"spins-{index}.csv.ZST", CompressionZstd},
+		{"spins-{index}.csv.zstd", CompressionZstd},
+	} {
+		parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, test.outputFileName), 1, 100, 10, 10)
+		if err != nil {
+			t.Fatalf("%s: failed to create extraction manager: %v", test.outputFileName, err)
+		}
+		result, err := parser.Extract(context.Background())
+		if err != nil {
+			t.Fatalf("%s: extraction failed: %v", test.outputFileName, err)
+		}
+		expected := filepath.Join(dir, strings.Replace(test.outputFileName, "{index}", "0", 1))
+		if len(result.OutputFiles) != 3 || result.OutputFiles[0] != expected {
+			t.Fatalf("%s: unexpected output files %v", test.outputFileName, result.OutputFiles)
+		}
+		for _, outputFile := range result.OutputFiles {
+			if rows := bytes.Count(decompressFile(t, outputFile, test.compression), []byte("\n")); rows == 0 {
+				t.Errorf("%s: expected compressed rows", outputFile)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Placeholders supported in output file name templates
+const (
+	PlaceholderIndex     = "index"     // rotation index, "{index:05}" pads it to 5 digits
+	PlaceholderRun       = "run"       // run ID
+	PlaceholderDate      = "date"      // run start date, 2006-01-02
+	PlaceholderHour      = "hour"      // run start hour, 15
+	PlaceholderTime      = "time"      // run start time of day, 150405
+	PlaceholderTimestamp = "timestamp" // run start, 20060102T150405Z
+	PlaceholderPartition = "partition" // partition key of the run
+	PlaceholderInput     = "input"     // name of the first input file without directory and extensions
+)
+
+var placeholderPattern = regexp.MustCompile(`\{([a-z]+)(?::(\d+))?\}`)
+
+// outputTemplate turns an outputFileName such as "out/{date}/spins-{run}-{index:05}.csv"
+// into the name of each rotated output file.
+type outputTemplate struct {
+	pattern string
+}
+
+// parseOutputTemplate validates the template placeholders.
+// The legacy printf form "output-%d.csv" is accepted as an alias of "output-{index}.csv", and a template
+// without an index, like "output.csv", gets "-{index}" inserted before its extension so rotated files never
+// overwrite each other.
+func parseOutputTemplate(pattern, extension string) (*outputTemplate, error) {
+	pattern = strings.ReplaceAll(pattern, "%d", "{"+PlaceholderIndex+"}")
+	hasIndex, err := validateTemplate(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, base := filepath.Split(pattern)
+	if base == "" {
+		return nil, fmt.Errorf("output file name %q has no file name", pattern)
+	}
+	name, ext := base, ""
+	if dot := strings.Index(base, "."); dot > 0 {
+		name, ext = base[:dot], base[dot:]
+	}
+	if !hasIndex {
+		name += "-{" + PlaceholderIndex + "}"
+	}
+	if ext == "" && extension != "" {
+		ext = "." + extension
+	}
+	return &outputTemplate{pattern: dir + name + ext}, nil
+}
+
+// appendExtension adds an extension, such as the one of the output compression, unless the template
+// already ends with it
+func (t *outputTemplate) appendExtension(extension string) {
+	if !strings.HasSuffix(t.pattern, extension) {
+		t.pattern += extension
+	}
+}
+
+// validateTemplate checks the placeholders of a file name template and reports whether it contains {index}
+func validateTemplate(pattern string) (bool, error) {
+	hasIndex := false
+	for _, match := range placeholderPattern.FindAllStringSubmatch(pattern, -1) {
+		switch match[1] {
+		case PlaceholderIndex:
+			hasIndex = true
+		case PlaceholderRun, PlaceholderDate, PlaceholderHour, PlaceholderTime, PlaceholderTimestamp, PlaceholderPartition, PlaceholderInput:
+			if match[2] != "" {
+				return false, fmt.Errorf("file name %q: only {index} accepts a width", pattern)
+			}
+		default:
+			return false, fmt.Errorf("file name %q: unknown placeholder %q", pattern, match[0])
+		}
+	}
+	return hasIndex, nil
+}
+
+// templateValues are the run level values substituted into an output template
+type templateValues struct {
+	runID     string
+	startTime time.Time
+	partition string
+	input     string
+}
+
+// Name returns the output file name for the given rotation index
+func (t *outputTemplate) Name(index int, values templateValues) string {
+	return expandTemplate(t.pattern, index, values)
+}
+
+// expandTemplate substitutes the placeholders of a file name template
+func expandTemplate(pattern string, index int, values templateValues) string {
+	return placeholderPattern.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		match := placeholderPattern.FindStringSubmatch(placeholder)
+		switch match[1] {
+		case PlaceholderIndex:
+			width, _ := strconv.Atoi(match[2])
+			return fmt.Sprintf("%0*d", width, index)
+		case PlaceholderRun:
+			return values.runID
+		case PlaceholderPartition:
+			return values.partition
+		case PlaceholderInput:
+			return values.input
+		}
+		return formatTime(match[1], values.startTime, placeholder)
+	})
+}
+
+// ExpandTimePlaceholders substitutes the {date}, {hour}, {time} and {timestamp} placeholders of a file name
+// with t and leaves the others to the run. It names the files of a scheduled run after its scheduled time.
+func ExpandTimePlaceholders(pattern string, t time.Time) string {
+	return placeholderPattern.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		return formatTime(placeholderPattern.FindStringSubmatch(placeholder)[1], t, placeholder)
+	})
+}
+
+// formatTime returns the value of a time placeholder in UTC, or the placeholder itself for other names
+func formatTime(name string, t time.Time, placeholder string) string {
+	switch t = t.UTC(); name {
+	case PlaceholderDate:
+		return t.Format("2006-01-02")
+	case PlaceholderHour:
+		return t.Format("15")
+	case PlaceholderTime:
+		return t.Format("150405")
+	case PlaceholderTimestamp:
+		return t.Format("20060102T150405Z")
+	}
+	return placeholder
+}
+
+// inputExtensions are the extensions inputBaseName strips, data formats and compressions
+var inputExtensions = []string{".json", ".jsonl", ".ndjson", ".csv", ".tsv", ".txt", ".gz", ".zst", ".zstd", ".bz2", ".xz"}
+
+// inputBaseName returns the name of an input file without its directory and its known data and compression
+// extensions, "spins" for "inbox/spins.json.gz". Other dots are kept, "spins.2026-10-18T10" for
+// "inbox/spins.2026-10-18T10.jsonl.gz".
+func inputBaseName(fileName string) string {
+	base := filepath.Base(fileName)
+	for {
+		ext := filepath.Ext(base)
+		if ext == "" || ext == base || !slices.Contains(inputExtensions, strings.ToLower(ext)) {
+			return base
+		}
+		base = strings.TrimSuffix(base, ext)
+	}
+}
+
+// newRunID returns a sortable, unique enough identifier for an extraction run
+func newRunID(now time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return now.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+}
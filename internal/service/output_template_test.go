@@ -0,0 +1,69 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutputTemplateName(t *testing.T) {
+	values := templateValues{
+		runID:     "run1",
+		startTime: time.Date(2025, 5, 24, 13, 4, 5, 0, time.UTC),
+		partition: "eu",
+		input:     "spins",
+	}
+	tests := []struct {
+		pattern   string
+		extension string
+		index     int
+		expected  string
+	}{
+		{"output.csv", "csv", 3, "output-3.csv"},
+		{"output-%d.csv", "csv", 0, "output-0.csv"},
+		{"output", "ndjson", 1, "output-1.ndjson"},
+		{"out/{date}/spins-{run}-{index:05}.csv.gz", "csv", 7, "out/2025-05-24/spins-run1-00007.csv.gz"},
+		{"{partition}/{timestamp}-{time}.parquet", "parquet", 2, "eu/20250524T130405Z-130405-2.parquet"},
+		{"{date}/{hour}.csv", "csv", 1, "2025-05-24/13-1.csv"},
+		{"processed/{input}-{index}.csv", "csv", 0, "processed/spins-0.csv"},
+	}
+	for _, test := range tests {
+		template, err := parseOutputTemplate(test.pattern, test.extension)
+		if err != nil {
+			t.Fatalf("parseOutputTemplate(%q) failed: %v", test.pattern, err)
+		}
+		if name := template.Name(test.index, values); name != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.pattern, test.expected, name)
+		}
+	}
+}
+
+func TestOutputTemplateInvalid(t *testing.T) {
+	for _, pattern := range []string{"out-{day}.csv", "out-{run:3}.csv", "out/"} {
+		if _, err := parseOutputTemplate(pattern, "csv"); err == nil {
+			t.Errorf("Expected %q to be rejected", pattern)
+		}
+	}
+}
+
+func TestExpandTimePlaceholders(t *testing.T) {
+	at := time.Date(2025, 5, 24, 15, 4, 5, 0, time.FixedZone("CEST", 2*3600))
+	name := ExpandTimePlaceholders("shards/{date}/{hour}/*.json-{run}-{index:03}-{timestamp}", at)
+	if expected := "shards/2025-05-24/13/*.json-{run}-{index:03}-20250524T130405Z"; name != expected {
+		t.Errorf("Expected %q, got %q", expected, name)
+	}
+}
+
+func TestInputBaseName(t *testing.T) {
+	for fileName, expected := range map[string]string{
+		"inbox/spins.json.gz":                 "spins",
+		"inbox/spins.2026-10-18T10.jsonl.gz":  "spins.2026-10-18T10",
+		"inbox/spins.2026-10-18T11.JSONL.ZST": "spins.2026-10-18T11",
+		"spins.v2":                            "spins.v2",
+		".json":                               ".json",
+		"spins":                               "spins",
+	} {
+		if name := inputBaseName(fileName); name != expected {
+			t.Errorf("%q: expected %q, got %q", fileName, expected, name)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Supported output formats
+const (
+	FormatCSV     = "csv"
+	FormatTSV     = "tsv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// OutputWriter encodes extracted rows into an output destination.
+// Open starts writing to a destination, Rotate closes the current destination and continues
+// in a new one, and Close flushes and closes the current destination.
+type OutputWriter interface {
+	Open(dst io.WriteCloser) error
+	Write(row []string) error
+	Flush() error
+	Close() error
+	Rotate(dst io.WriteCloser) error
+	// Extension is the file extension, without the dot, used for files of this format
+	Extension() string
+}
+
+// NewOutputWriter returns the writer for the given format. An empty format selects CSV.
+func NewOutputWriter(format string, columns []Column) (OutputWriter, error) {
+	switch format {
+	case "", FormatCSV:
+		return &csvOutputWriter{comma: ',', extension: FormatCSV}, nil
+	case FormatTSV:
+		return &csvOutputWriter{comma: '\t', extension: FormatTSV}, nil
+	case FormatNDJSON:
+		return &ndjsonOutputWriter{columns: columns}, nil
+	case FormatParquet:
+		return newParquetOutputWriter(columns), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// csvOutputWriter writes delimiter separated rows, used for both CSV and TSV
+type csvOutputWriter struct {
+	comma     rune
+	extension string
+	dst       io.WriteCloser
+	writer    *csv.Writer
+}
+
+func (w *csvOutputWriter) Open(dst io.WriteCloser) error {
+	w.dst = dst
+	w.writer = csv.NewWriter(dst)
+	w.writer.Comma = w.comma
+	return nil
+}
+
+func (w *csvOutputWriter) Write(row []string) error {
+	return w.writer.Write(row)
+}
+
+func (w *csvOutputWriter) Flush() error {
+	if w.writer == nil {
+		return nil
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvOutputWriter) Close() error {
+	if w.dst == nil {
+		return nil
+	}
+	err := w.Flush()
+	if closeErr := w.dst.Close(); err == nil {
+		err = closeErr
+	}
+	w.dst, w.writer = nil, nil
+	return err
+}
+
+func (w *csvOutputWriter) Rotate(dst io.WriteCloser) error {
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return w.Open(dst)
+}
+
+func (w *csvOutputWriter) Extension() string {
+	return w.extension
+}
+
+// ndjsonOutputWriter writes one JSON object per row, keeping the configured column order
+// and emitting numbers and booleans unquoted
+type ndjsonOutputWriter struct {
+	columns []Column
+	dst     io.WriteCloser
+	writer  *bufio.Writer
+	buffer  []byte
+}
+
+func (w *ndjsonOutputWriter) Open(dst io.WriteCloser) error {
+	w.dst = dst
+	w.writer = bufio.NewWriter(dst)
+	return nil
+}
+
+func (w *ndjsonOutputWriter) Write(row []string) error {
+	w.buffer = append(w.buffer[:0], '{')
+	for i, column := range w.columns {
+		if i > 0 {
+			w.buffer = append(w.buffer, ',')
+		}
+		name, err := json.Marshal(column.Name)
+		if err != nil {
+			return err
+		}
+		w.buffer = append(w.buffer, name...)
+		w.buffer = append(w.buffer, ':')
+		if column.Type == ColumnString {
+			value, err := json.Marshal(row[i])
+			if err != nil {
+				return err
+			}
+			w.buffer = append(w.buffer, value...)
+		} else {
+			w.buffer = append(w.buffer, row[i]...)
+		}
+	}
+	w.buffer = append(w.buffer, '}', '\n')
+	_, err := w.writer.Write(w.buffer)
+	return err
+}
+
+func (w *ndjsonOutputWriter) Flush() error {
+	if w.writer == nil {
+		return nil
+	}
+	return w.writer.Flush()
+}
+
+func (w *ndjsonOutputWriter) Close() error {
+	if w.dst == nil {
+		return nil
+	}
+	err := w.Flush()
+	if closeErr := w.dst.Close(); err == nil {
+		err = closeErr
+	}
+	w.dst, w.writer = nil, nil
+	return err
+}
+
+func (w *ndjsonOutputWriter) Rotate(dst io.WriteCloser) error {
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return w.Open(dst)
+}
+
+func (w *ndjsonOutputWriter) Extension() string {
+	return FormatNDJSON
+}
+
+// parquetOutputWriter writes one parquet file per destination with a typed column per configured column
+type parquetOutputWriter struct {
+	columns []Column
+	schema  *parquet.Schema
+	leaves  []int // leaves[i] is the parquet column index of columns[i]
+	dst     io.WriteCloser
+	writer  *parquet.Writer
+	rows    []parquet.Row
+}
+
+// parquetBatchSize is the number of rows buffered before they are handed to the parquet writer
+const parquetBatchSize = 1024
+
+func newParquetOutputWriter(columns []Column) *parquetOutputWriter {
+	group := parquet.Group{}
+	for _, column := range columns {
+		switch column.Type {
+		case ColumnInt:
+			group[column.Name] = parquet.Int(64)
+		case ColumnFloat:
+			group[column.Name] = parquet.Leaf(parquet.DoubleType)
+		case ColumnBool:
+			group[column.Name] = parquet.Leaf(parquet.BooleanType)
+		default:
+			group[column.Name] = parquet.String()
+		}
+	}
+
+	// Parquet orders the fields of a group by name, remember where each configured column ended up
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	sort.Strings(names)
+	leaves := make([]int, len(columns))
+	for i, column := range columns {
+		leaves[i] = sort.SearchStrings(names, column.Name)
+	}
+
+	return &parquetOutputWriter{
+		columns: columns,
+		schema:  parquet.NewSchema("record", group),
+		leaves:  leaves,
+	}
+}
+
+func (w *parquetOutputWriter) Open(dst io.WriteCloser) error {
+	w.dst = dst
+	w.writer = parquet.NewWriter(dst, w.schema)
+	return nil
+}
+
+func (w *parquetOutputWriter) Write(row []string) error {
+	values := make(parquet.Row, len(w.columns))
+	for i, column := range w.columns {
+		value, err := parquetValue(column.Type, row[i])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", column.Name, err)
+		}
+		values[w.leaves[i]] = value.Level(0, 0, w.leaves[i])
+	}
+	w.rows = append(w.rows, values)
+	if len(w.rows) >= parquetBatchSize {
+		return w.writeBatch()
+	}
+	return nil
+}
+
+func (w *parquetOutputWriter) writeBatch() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	_, err := w.writer.WriteRows(w.rows)
+	w.rows = w.rows[:0]
+	return err
+}
+
+func (w *parquetOutputWriter) Flush() error {
+	if w.writer == nil {
+		return nil
+	}
+	if err := w.writeBatch(); err != nil {
+		return err
+	}
+	return w.writer.Flush()
+}
+
+func (w *parquetOutputWriter) Close() error {
+	if w.dst == nil {
+		return nil
+	}
+	err := w.writeBatch()
+	if closeErr := w.writer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := w.dst.Close(); err == nil {
+		err = closeErr
+	}
+	w.dst, w.writer = nil, nil
+	return err
+}
+
+func (w *parquetOutputWriter) Rotate(dst io.WriteCloser) error {
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return w.Open(dst)
+}
+
+func (w *parquetOutputWriter) Extension() string {
+	return FormatParquet
+}
+
+func parquetValue(columnType ColumnType, value string) (parquet.Value, error) {
+	switch columnType {
+	case ColumnInt:
+		i, err := strconv.ParseInt(value, 10, 64)
+		return parquet.ValueOf(i), err
+	case ColumnFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		return parquet.ValueOf(f), err
+	case ColumnBool:
+		b, err := strconv.ParseBool(value)
+		return parquet.ValueOf(b), err
+	}
+	return parquet.ValueOf(value), nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type bufferCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+var writerTestColumns = []Column{
+	{Source: "spins", Name: "spins", Type: ColumnInt},
+	{Source: "server_time", Name: "server_time", Type: ColumnString},
+	{Source: "active", Name: "active", Type: ColumnBool},
+}
+
+func writeRows(t *testing.T, writer OutputWriter, rows ...[]string) *bufferCloser {
+	t.Helper()
+	dst := &bufferCloser{}
+	if err := writer.Open(dst); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for _, row := range rows {
+		if err := writer.Write(row); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !dst.closed {
+		t.Error("Destination was not closed")
+	}
+	return dst
+}
+
+func TestDelimitedOutputWriters(t *testing.T) {
+	tests := map[string]string{
+		FormatCSV: "10,\"a,b\",true\n",
+		FormatTSV: "10\ta,b\ttrue\n",
+	}
+	for format, expected := range tests {
+		writer, err := NewOutputWriter(format, writerTestColumns)
+		if err != nil {
+			t.Fatalf("NewOutputWriter(%s) failed: %v", format, err)
+		}
+		dst := writeRows(t, writer, []string{"10", "a,b", "true"})
+		if dst.String() != expected {
+			t.Errorf("%s: expected %q, got %q", format, expected, dst.String())
+		}
+	}
+}
+
+func TestNDJSONOutputWriter(t *testing.T) {
+	writer, _ := NewOutputWriter(FormatNDJSON, writerTestColumns)
+	dst := writeRows(t, writer, []string{"10", "2025-05-24 \"UTC\"", "false"})
+	expected := `{"spins":10,"server_time":"2025-05-24 \"UTC\"","active":false}` + "\n"
+	if dst.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, dst.String())
+	}
+}
+
+func TestParquetOutputWriter(t *testing.T) {
+	writer, _ := NewOutputWriter(FormatParquet, writerTestColumns)
+	dst := writeRows(t, writer, []string{"10", "first", "true"}, []string{"20", "second", "false"})
+
+	file, err := parquet.OpenFile(bytes.NewReader(dst.Bytes()), int64(dst.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read parquet output: %v", err)
+	}
+	if file.NumRows() != 2 {
+		t.Errorf("Expected 2 rows, got %d", file.NumRows())
+	}
+
+	rows := make([]parquet.Row, 2)
+	reader := parquet.NewReader(file)
+	if n, _ := reader.ReadRows(rows); n != 2 {
+		t.Fatalf("Expected to read 2 rows, got %d", n)
+	}
+	// Columns are stored in name order: active, server_time, spins
+	if rows[1][1].String() != "second" || rows[1][2].Int64() != 20 || rows[1][0].Boolean() {
+		t.Errorf("Unexpected second row %v", rows[1])
+	}
+}
+
+func TestOutputWriterRotate(t *testing.T) {
+	writer, _ := NewOutputWriter(FormatCSV, writerTestColumns)
+	first, second := &bufferCloser{}, &bufferCloser{}
+	writer.Open(first)
+	writer.Write([]string{"1", "a", "true"})
+	if err := writer.Rotate(second); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	writer.Write([]string{"2", "b", "false"})
+	writer.Close()
+
+	if !first.closed || first.String() != "1,a,true\n" {
+		t.Errorf("Unexpected first destination %q (closed=%v)", first.String(), first.closed)
+	}
+	if second.String() != "2,b,false\n" {
+		t.Errorf("Unexpected second destination %q", second.String())
+	}
+}
+
+func TestNewOutputWriterUnknownFormat(t *testing.T) {
+	if _, err := NewOutputWriter("xml", writerTestColumns); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
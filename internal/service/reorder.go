@@ -0,0 +1,71 @@
+package service
+
+import "context"
+
+// outputRow is an extracted row tagged with the position of the line it came from.
+// In order-preserving mode malformed lines are sent with a nil row so the sequence has no gaps.
+type outputRow struct {
+	seq    int64 // Position of the line in the whole input
+	source int   // Index of the input file
+	line   int64 // Line number in the input file
+	end    int64 // Input file offset after the line
+	row    []string
+	// rejected is the dead-letter record of a rejected line when order is preserved, it is written once the
+	// line is committed so a checkpoint covers the records of its lines
+	rejected *DeadLetterRecord
+}
+
+// DefaultReorderBufferSize is the number of lines that may be in flight when order is preserved
+// and no buffer size is configured
+const DefaultReorderBufferSize = 1024
+
+// reorderBuffer restores input order for rows processed out of order by the workers.
+// The reader takes a slot for every line it sends and the buffer gives it back once the line is emitted,
+// so at most cap(slots) lines are held between the reader and the writer at any time.
+type reorderBuffer struct {
+	next    int64 // next sequence number to emit
+	pending map[int64]outputRow
+	slots   chan struct{}
+	ready   []outputRow
+}
+
+// newReorderBuffer returns a buffer emitting rows from sequence number first on
+func newReorderBuffer(size int, first int64) *reorderBuffer {
+	return &reorderBuffer{
+		next:    first,
+		pending: make(map[int64]outputRow, size),
+		slots:   make(chan struct{}, size),
+	}
+}
+
+// acquire blocks until a line may be sent to the workers, it returns false when ctx is cancelled first
+func (b *reorderBuffer) acquire(ctx context.Context) bool {
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// push adds a processed row and returns the rows, in input order, that can now be committed.
+// Rows of malformed lines are included with a nil row. The returned slice is only valid until the next call.
+func (b *reorderBuffer) push(result outputRow) []outputRow {
+	b.ready = b.ready[:0]
+	if result.seq != b.next {
+		b.pending[result.seq] = result
+		return b.ready
+	}
+
+	for {
+		b.ready = append(b.ready, result)
+		<-b.slots
+		b.next++
+
+		var ok bool
+		if result, ok = b.pending[b.next]; !ok {
+			return b.ready
+		}
+		delete(b.pending, b.next)
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestReorderBufferPush(t *testing.T) {
+	buffer := newReorderBuffer(4, 1)
+	for i := 0; i < 4; i++ {
+		buffer.acquire(context.Background())
+	}
+
+	if ready := buffer.push(outputRow{seq: 3, row: []string{"3"}}); len(ready) != 0 {
+		t.Errorf("Row 3 must wait for rows 1 and 2, got %v", ready)
+	}
+	if ready := buffer.push(outputRow{seq: 2}); len(ready) != 0 {
+		t.Errorf("Skipped row 2 must wait for row 1, got %v", ready)
+	}
+	ready := buffer.push(outputRow{seq: 1, row: []string{"1"}})
+	expected := []outputRow{{seq: 1, row: []string{"1"}}, {seq: 2}, {seq: 3, row: []string{"3"}}}
+	if !reflect.DeepEqual(ready, expected) {
+		t.Errorf("Expected rows 1 to 3, got %v", ready)
+	}
+	if len(buffer.slots) != 1 || len(buffer.pending) != 0 {
+		t.Errorf("Expected 3 slots released and nothing pending, got %d slots and %v", len(buffer.slots), buffer.pending)
+	}
+}
+
+func TestExtractPreserveOrder(t *testing.T) {
+	dir := t.TempDir()
+	inputFileName := filepath.Join(dir, "input.json")
+	file, _ := os.Create(inputFileName)
+	for i := 0; i < 5000; i++ {
+		if i%97 == 0 {
+			file.WriteString("not json\n")
+			continue
+		}
+		fmt.Fprintf(file, `{"spins": %d, "server_time": "t"}`+"\n", i)
+	}
+	file.Close()
+
+	parser, err := NewExtractionManager(inputFileName, filepath.Join(dir, "output.csv"), 8, 1000, 10, 10, WithPreserveOrder(16))
+	if err != nil {
+		t.Fatalf("Failed to create extraction manager: %v", err)
+	}
+	result, err := parser.Extract(context.Background())
+	if err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+
+	previous := -1
+	for _, outputFileName := range result.OutputFiles {
+		output, err := os.Open(outputFileName)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", outputFileName, err)
+		}
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			spins, _ := strconv.Atoi(scanner.Text()[:len(scanner.Text())-2])
+			if spins <= previous {
+				t.Fatalf("Row %d written after row %d", spins, previous)
+			}
+			previous = spins
+		}
+		output.Close()
+	}
+	if previous != 4999 {
+		t.Errorf("Expected the last row to be 4999, got %d", previous)
+	}
+}
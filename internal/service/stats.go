@@ -0,0 +1,110 @@
+package service
+
+import (
+	"hash"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExtractionStats holds the counters of a single extraction run.
+// The fields are updated atomically while the run is in progress; the copy returned
+// in ExtractionResult is a snapshot taken after the run finished.
+type ExtractionStats struct {
+	LinesRead      int64         `json:"linesRead"`
+	LinesParsed    int64         `json:"linesParsed"`
+	LinesMalformed int64         `json:"linesMalformed"`
+	LinesTooLong   int64         `json:"linesTooLong"` // Malformed lines rejected for exceeding the maximum line size
+	LinesWritten   int64         `json:"linesWritten"`
+	FilesCreated   int64         `json:"filesCreated"`
+	BytesIn        int64         `json:"bytesIn"`
+	BytesOut       int64         `json:"bytesOut"`
+	ReadDuration   time.Duration `json:"readDuration"`  // Wall time of the reader
+	ParseDuration  time.Duration `json:"parseDuration"` // Time spent parsing, summed over all workers
+	WriteDuration  time.Duration `json:"writeDuration"` // Time spent encoding and writing output
+}
+
+func (s *ExtractionStats) add(counter *int64, n int64) int64 {
+	return atomic.AddInt64(counter, n)
+}
+
+func (s *ExtractionStats) addDuration(duration *time.Duration, since time.Time) {
+	atomic.AddInt64((*int64)(duration), int64(time.Since(since)))
+}
+
+// Snapshot returns a consistent copy of the counters
+func (s *ExtractionStats) Snapshot() ExtractionStats {
+	return ExtractionStats{
+		LinesRead:      atomic.LoadInt64(&s.LinesRead),
+		LinesParsed:    atomic.LoadInt64(&s.LinesParsed),
+		LinesMalformed: atomic.LoadInt64(&s.LinesMalformed),
+		LinesTooLong:   atomic.LoadInt64(&s.LinesTooLong),
+		LinesWritten:   atomic.LoadInt64(&s.LinesWritten),
+		FilesCreated:   atomic.LoadInt64(&s.FilesCreated),
+		BytesIn:        atomic.LoadInt64(&s.BytesIn),
+		BytesOut:       atomic.LoadInt64(&s.BytesOut),
+		ReadDuration:   time.Duration(atomic.LoadInt64((*int64)(&s.ReadDuration))),
+		ParseDuration:  time.Duration(atomic.LoadInt64((*int64)(&s.ParseDuration))),
+		WriteDuration:  time.Duration(atomic.LoadInt64((*int64)(&s.WriteDuration))),
+	}
+}
+
+// Fields returns the counters as structured log fields
+func (s ExtractionStats) Fields() logrus.Fields {
+	return logrus.Fields{
+		"linesRead":      s.LinesRead,
+		"linesParsed":    s.LinesParsed,
+		"linesMalformed": s.LinesMalformed,
+		"linesTooLong":   s.LinesTooLong,
+		"linesWritten":   s.LinesWritten,
+		"filesCreated":   s.FilesCreated,
+		"bytesIn":        s.BytesIn,
+		"bytesOut":       s.BytesOut,
+		"readDuration":   s.ReadDuration.String(),
+		"parseDuration":  s.ParseDuration.String(),
+		"writeDuration":  s.WriteDuration.String(),
+	}
+}
+
+// countingReader adds the number of bytes read to a counter, and feeds them to hash when it is set
+type countingReader struct {
+	reader  io.Reader
+	stats   *ExtractionStats
+	counter *int64
+	hash    hash.Hash
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.stats.add(r.counter, int64(n))
+	if r.hash != nil {
+		r.hash.Write(b[:n])
+	}
+	return n, err
+}
+
+// countingWriteCloser adds the number of bytes written to a counter and tracks the size of its destination.
+// When hash is set it also checksums the content of the destination.
+type countingWriteCloser struct {
+	writer  io.WriteCloser
+	stats   *ExtractionStats
+	counter *int64
+	written int64     // Size of the destination, only used by the writing goroutine
+	hash    hash.Hash // SHA-256 of the destination, nil unless a manifest is written
+}
+
+func (w *countingWriteCloser) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	w.stats.add(w.counter, int64(n))
+	w.written += int64(n)
+	if w.hash != nil {
+		w.hash.Write(b[:n])
+	}
+	return n, err
+}
+
+func (w *countingWriteCloser) Close() error {
+	return w.writer.Close()
+}
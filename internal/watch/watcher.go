@@ -0,0 +1,232 @@
+// Package watch extracts the files landing in an inbox directory, one at a time, and files them away
+// once they are done
+package watch
+
+import (
+	"assignment/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultStableFor is how long a file has to keep its size and modification time before it is extracted
+	DefaultStableFor = 5 * time.Second
+	// ProcessedDir and FailedDir are the default directories, inside the inbox, receiving the extracted files
+	ProcessedDir = "processed"
+	FailedDir    = "failed"
+	// errorSuffix is appended to the name of a failed file to write its error next to it
+	errorSuffix = ".error"
+)
+
+// Config sets up a Watcher
+type Config struct {
+	Inbox        string        // Directory receiving the input files
+	ProcessedDir string        // Extracted files are moved here, Inbox/processed when empty
+	FailedDir    string        // Files whose extraction failed are moved here, Inbox/failed when empty
+	StableFor    time.Duration // Quiet period marking a file as complete, DefaultStableFor when 0
+	// DoneSuffix, when set, marks a file as complete once a marker named after it with this suffix exists,
+	// e.g. "spins.json.done" for "spins.json" and ".done". The marker is removed after the extraction.
+	DoneSuffix string
+}
+
+// ExtractFunc extracts one input file. The extraction is stopped when ctx is cancelled.
+type ExtractFunc func(ctx context.Context, inputFile string) error
+
+// fileState is the last size and modification time seen for a file of the inbox
+type fileState struct {
+	size    int64
+	modTime time.Time
+	since   time.Time // When the file was last seen changing
+}
+
+// Watcher waits for files to be complete in the inbox and extracts them in name order. Hidden files and
+// names ending in .tmp or .part, which are usually uploads in progress, are left alone.
+type Watcher struct {
+	config  Config
+	extract ExtractFunc
+	files   map[string]fileState // Files of the inbox waiting to be stable
+	now     func() time.Time
+}
+
+// New checks the inbox exists and creates the processed and failed directories
+func New(cfg Config, extract ExtractFunc) (*Watcher, error) {
+	if info, err := os.Stat(cfg.Inbox); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("inbox %q is not a directory", cfg.Inbox)
+	}
+	if cfg.ProcessedDir == "" {
+		cfg.ProcessedDir = filepath.Join(cfg.Inbox, ProcessedDir)
+	}
+	if cfg.FailedDir == "" {
+		cfg.FailedDir = filepath.Join(cfg.Inbox, FailedDir)
+	}
+	if cfg.StableFor <= 0 {
+		cfg.StableFor = DefaultStableFor
+	}
+	for _, dir := range []string{cfg.ProcessedDir, cfg.FailedDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Watcher{config: cfg, extract: extract, files: make(map[string]fileState), now: time.Now}, nil
+}
+
+// Run extracts the files of the inbox, those already there first, until ctx is cancelled. A file whose
+// extraction is interrupted stays in the inbox and is extracted again by the next run. Run fails when
+// the inbox cannot be read or an extracted file cannot be moved out of it.
+func (w *Watcher) Run(ctx context.Context) error {
+	notifier, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer notifier.Close()
+	if err := notifier.Add(w.config.Inbox); err != nil {
+		return fmt.Errorf("watching %s: %w", w.config.Inbox, err)
+	}
+	logger.Info("Watching inbox", logrus.Fields{"inbox": w.config.Inbox, "processedDir": w.config.ProcessedDir, "failedDir": w.config.FailedDir})
+
+	// Events only trigger a scan of the inbox, so none is lost when the event queue overflows. The ticker
+	// notices files that became stable.
+	ticker := time.NewTicker(max(min(w.config.StableFor/2, time.Second), 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		if err := w.scan(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-notifier.Events:
+		case <-ticker.C:
+		case err := <-notifier.Errors:
+			logger.Warning("Inbox watch error, rescanning", logrus.Fields{"error": err})
+		}
+	}
+}
+
+// scan looks at every file of the inbox and extracts those that are complete
+func (w *Watcher) scan(ctx context.Context) error {
+	entries, err := os.ReadDir(w.config.Inbox)
+	if err != nil {
+		return fmt.Errorf("reading inbox: %w", err)
+	}
+	seen := make(map[string]bool, len(entries))
+	var ready []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || w.ignored(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Moved away in the meantime
+		}
+		seen[name] = true
+		if w.complete(name, info) {
+			ready = append(ready, name)
+		}
+	}
+	for name := range w.files {
+		if !seen[name] {
+			delete(w.files, name)
+		}
+	}
+
+	sort.Strings(ready)
+	for _, name := range ready {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := w.process(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ignored reports whether a file of the inbox is never extracted
+func (w *Watcher) ignored(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".part") ||
+		(w.config.DoneSuffix != "" && strings.HasSuffix(name, w.config.DoneSuffix))
+}
+
+// complete reports whether a file is ready: its marker exists, or it has not changed for StableFor
+func (w *Watcher) complete(name string, info os.FileInfo) bool {
+	if w.config.DoneSuffix != "" {
+		_, err := os.Stat(filepath.Join(w.config.Inbox, name+w.config.DoneSuffix))
+		return err == nil
+	}
+	now := w.now()
+	state, ok := w.files[name]
+	if !ok || state.size != info.Size() || !state.modTime.Equal(info.ModTime()) {
+		w.files[name] = fileState{size: info.Size(), modTime: info.ModTime(), since: now}
+		return false
+	}
+	return now.Sub(state.since) >= w.config.StableFor
+}
+
+// process extracts a file and moves it to the processed or failed directory. The error of the extraction
+// is written next to a failed file, only failing to move the file is returned.
+func (w *Watcher) process(ctx context.Context, name string) error {
+	inputFile := filepath.Join(w.config.Inbox, name)
+	fields := logrus.Fields{"inputFile": inputFile}
+	logger.Info("Extracting inbox file", fields)
+	err := w.extract(ctx, inputFile)
+	if ctx.Err() != nil {
+		logger.Info("Extraction interrupted, the file stays in the inbox", fields)
+		return nil
+	}
+	delete(w.files, name)
+
+	dir := w.config.ProcessedDir
+	if err != nil {
+		dir = w.config.FailedDir
+		fields["error"] = err
+		logger.Error("Extraction failed", fields)
+	}
+	target, moveErr := moveFile(inputFile, dir)
+	if moveErr != nil {
+		// The file would be extracted again at every scan
+		return fmt.Errorf("moving %s out of the inbox: %w", inputFile, moveErr)
+	}
+	if err != nil {
+		if writeErr := os.WriteFile(target+errorSuffix, []byte(err.Error()+"\n"), 0644); writeErr != nil {
+			logger.Warning("Failed to write the error file", logrus.Fields{"inputFile": target, "error": writeErr})
+		}
+	} else {
+		logger.Info("Inbox file extracted", logrus.Fields{"inputFile": inputFile, "movedTo": target})
+	}
+	if w.config.DoneSuffix != "" {
+		if err := os.Remove(inputFile + w.config.DoneSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warning("Failed to remove the done marker", logrus.Fields{"inputFile": inputFile, "error": err})
+		}
+	}
+	return nil
+}
+
+// moveFile moves a file into dir, numbering its name when dir already holds a file with that name.
+// Both directories have to be on the same file system.
+func moveFile(fileName, dir string) (string, error) {
+	base := filepath.Base(fileName)
+	name, ext := base, ""
+	if dot := strings.Index(base, "."); dot > 0 {
+		name, ext = base[:dot], base[dot:]
+	}
+	target := filepath.Join(dir, base)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(target); err != nil {
+			break
+		}
+		target = filepath.Join(dir, name+"-"+strconv.Itoa(i)+ext)
+	}
+	return target, os.Rename(fileName, target)
+}
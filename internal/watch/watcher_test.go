@@ -0,0 +1,198 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is an ExtractFunc recording the extracted files, it fails the files named "bad*"
+type recorder struct {
+	mu    sync.Mutex
+	files []string
+}
+
+func (r *recorder) extract(ctx context.Context, inputFile string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files = append(r.files, filepath.Base(inputFile))
+	if strings.HasPrefix(filepath.Base(inputFile), "bad") {
+		return errors.New("invalid input")
+	}
+	return nil
+}
+
+func (r *recorder) extracted() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.files...)
+}
+
+func writeFile(t *testing.T, fileName, content string) {
+	t.Helper()
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForFile polls until the file exists, or no longer exists
+func waitForFile(t *testing.T, fileName string, exists bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(fileName); (err == nil) == exists {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s to exist: %t", fileName, exists)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// run starts the watcher and returns a function stopping it
+func run(t *testing.T, watcher *Watcher) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- watcher.Run(ctx) }()
+	return func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run failed: %v", err)
+		}
+	}
+}
+
+func TestWatcherExtractsStableFiles(t *testing.T) {
+	inbox := t.TempDir()
+	// Files already in the inbox are extracted too
+	writeFile(t, filepath.Join(inbox, "a.json"), "{}\n")
+	extractor := &recorder{}
+	watcher, err := New(Config{Inbox: inbox, StableFor: 50 * time.Millisecond}, extractor.extract)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	stop := run(t, watcher)
+	defer stop()
+
+	writeFile(t, filepath.Join(inbox, "bad.json"), "{\n")
+	writeFile(t, filepath.Join(inbox, ".hidden.json"), "{}\n")
+	writeFile(t, filepath.Join(inbox, "upload.json.part"), "{}\n")
+	waitForFile(t, filepath.Join(inbox, ProcessedDir, "a.json"), true)
+	waitForFile(t, filepath.Join(inbox, FailedDir, "bad.json"), true)
+
+	errorFile := filepath.Join(inbox, FailedDir, "bad.json"+errorSuffix)
+	waitForFile(t, errorFile, true)
+	if data, _ := os.ReadFile(errorFile); string(data) != "invalid input\n" {
+		t.Errorf("Unexpected error file %q", data)
+	}
+	if files := extractor.extracted(); len(files) != 2 || files[0] != "a.json" || files[1] != "bad.json" {
+		t.Errorf("Expected a.json and bad.json to be extracted, got %v", files)
+	}
+	for _, name := range []string{".hidden.json", "upload.json.part"} {
+		if _, err := os.Stat(filepath.Join(inbox, name)); err != nil {
+			t.Errorf("Expected %s to be left in the inbox: %v", name, err)
+		}
+	}
+}
+
+func TestWatcherWaitsForDoneMarker(t *testing.T) {
+	inbox, processed := t.TempDir(), filepath.Join(t.TempDir(), "done")
+	extractor := &recorder{}
+	watcher, err := New(Config{Inbox: inbox, ProcessedDir: processed, DoneSuffix: ".done", StableFor: time.Millisecond}, extractor.extract)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	stop := run(t, watcher)
+	defer stop()
+
+	writeFile(t, filepath.Join(inbox, "spins.json"), "{}\n")
+	time.Sleep(100 * time.Millisecond)
+	if files := extractor.extracted(); len(files) != 0 {
+		t.Fatalf("Expected no extraction before the marker, got %v", files)
+	}
+	writeFile(t, filepath.Join(inbox, "spins.json.done"), "")
+	waitForFile(t, filepath.Join(processed, "spins.json"), true)
+	waitForFile(t, filepath.Join(inbox, "spins.json.done"), false)
+}
+
+func TestWatcherKeepsInterruptedFiles(t *testing.T) {
+	inbox := t.TempDir()
+	writeFile(t, filepath.Join(inbox, "spins.json"), "{}\n")
+	started := make(chan struct{})
+	extract := func(ctx context.Context, inputFile string) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	watcher, err := New(Config{Inbox: inbox, StableFor: time.Millisecond}, extract)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	stop := run(t, watcher)
+	<-started
+	stop()
+	if _, err := os.Stat(filepath.Join(inbox, "spins.json")); err != nil {
+		t.Errorf("Expected the interrupted file to stay in the inbox: %v", err)
+	}
+}
+
+func TestWatcherStability(t *testing.T) {
+	watcher, err := New(Config{Inbox: t.TempDir(), StableFor: time.Minute}, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	start := time.Date(2025, 5, 24, 0, 0, 0, 0, time.UTC)
+	now := start
+	watcher.now = func() time.Time { return now }
+	fileName := filepath.Join(watcher.config.Inbox, "spins.json")
+	writeFile(t, fileName, "{}\n")
+	info, _ := os.Stat(fileName)
+
+	for _, step := range []struct {
+		elapsed  time.Duration // Since the file was first seen
+		content  string        // Appended to the file when set
+		complete bool
+	}{
+		{0, "", false},                // First seen
+		{30 * time.Second, "", false}, // Not quiet for long enough
+		{time.Minute, "{}\n", false},  // Changed, the period starts again
+		{90 * time.Second, "", false},
+		{2 * time.Minute, "", true},
+	} {
+		now = start.Add(step.elapsed)
+		if step.content != "" {
+			file, _ := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0)
+			file.WriteString(step.content)
+			file.Close()
+			info, _ = os.Stat(fileName)
+		}
+		if complete := watcher.complete("spins.json", info); complete != step.complete {
+			t.Errorf("After %s: expected complete=%t", step.elapsed, step.complete)
+		}
+	}
+}
+
+func TestMoveFileNumbersNames(t *testing.T) {
+	inbox, dir := t.TempDir(), t.TempDir()
+	for i, expected := range []string{"spins.json.gz", "spins-1.json.gz", "spins-2.json.gz"} {
+		fileName := filepath.Join(inbox, "spins.json.gz")
+		writeFile(t, fileName, strings.Repeat("x", i))
+		target, err := moveFile(fileName, dir)
+		if err != nil || target != filepath.Join(dir, expected) {
+			t.Errorf("Expected %s, got %s, %v", expected, target, err)
+		}
+	}
+}
+
+func TestNewRejectsMissingInbox(t *testing.T) {
+	if _, err := New(Config{Inbox: filepath.Join(t.TempDir(), "missing")}, nil); err == nil {
+		t.Error("Expected a missing inbox to be rejected")
+	}
+}
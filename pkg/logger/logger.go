@@ -7,13 +7,17 @@ import (
 	"time"
 )
 
-var log *logrus.Logger
+// log defaults to a plain logrus logger so packages can log before InitLogger is called
+var log = logrus.New()
+
+// Fields are the structured fields of a log entry
+type Fields = logrus.Fields
 
 // LogConfig holds the configuration for the logger
 type LogConfig struct {
 	Level      string
 	Format     string // "json" or "text"
-	OutputPath string
+	OutputPath string // Log file, "stderr" for standard error, standard output when empty
 }
 
 // InitLogger initializes the logger with the given configuration
@@ -40,7 +44,9 @@ func InitLogger(config LogConfig) error {
 	}
 	
 	// Set output
-	if config.OutputPath != "" {
+	if config.OutputPath == "stderr" {
+		log.SetOutput(os.Stderr)
+	} else if config.OutputPath != "" {
 		file, err := os.OpenFile(config.OutputPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 		if err != nil {
 			return err
@@ -42,6 +42,38 @@ var (
 		},
 		[]string{"type"},
 	)
+
+	// Pipeline metrics
+	LinesProcessed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lines_processed_total",
+			Help: "Total number of lines read, parsed and written",
+		},
+		[]string{"stage"},
+	)
+
+	MalformedLines = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "malformed_lines_total",
+			Help: "Total number of malformed input lines",
+		},
+		[]string{"reason"},
+	)
+
+	ChannelOccupancy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "channel_occupancy",
+			Help: "Current number of items queued in processing channels",
+		},
+		[]string{"channel"},
+	)
+
+	OutputRotations = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "output_file_rotations_total",
+			Help: "Total number of output file rotations",
+		},
+	)
 )
 
 // TrackDuration measures the duration of an operation
@@ -57,4 +89,9 @@ func RecordError(errorType string) {
 // UpdateChannelCapacity updates the channel capacity metric
 func UpdateChannelCapacity(channelName string, capacity float64) {
 	ChannelCapacity.WithLabelValues(channelName).Set(capacity)
-} 
\ No newline at end of file
+}
+
+// RecordMalformed increments the malformed line counter for a specific reason
+func RecordMalformed(reason string) {
+	MalformedLines.WithLabelValues(reason).Inc()
+}